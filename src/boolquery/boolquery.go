@@ -0,0 +1,365 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package boolquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	operatorAnd string = "AND"
+	operatorOr  string = "OR"
+	operatorNot string = "NOT"
+)
+
+type tokenType int
+
+const (
+	tokenTerm tokenType = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenType
+	text string
+}
+
+// Node of a parsed query
+type node struct {
+	// Term to look for; empty for operators
+	term     string
+	operator string
+	children []*node
+}
+
+// Parsed boolean query like `wecr AND (crawler OR "web scraper") NOT python`.
+// Terms next to each other are implicitly joined with AND; operators must be upper case
+type Query struct {
+	root *node
+}
+
+// Split query into terms, phrases, operators and parentheses
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	var runes []rune = []rune(query)
+
+	for index := 0; index < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[index]):
+			index++
+
+		case runes[index] == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			index++
+
+		case runes[index] == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			index++
+
+		case runes[index] == '"':
+			end := index + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("phrase is not closed with a quote")
+			}
+
+			phrase := strings.TrimSpace(string(runes[index+1 : end]))
+			if phrase == "" {
+				return nil, fmt.Errorf("empty phrase")
+			}
+			tokens = append(tokens, token{kind: tokenTerm, text: phrase})
+			index = end + 1
+
+		default:
+			end := index
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+
+			word := string(runes[index:end])
+			switch word {
+			case operatorAnd:
+				tokens = append(tokens, token{kind: tokenAnd})
+			case operatorOr:
+				tokens = append(tokens, token{kind: tokenOr})
+			case operatorNot:
+				tokens = append(tokens, token{kind: tokenNot})
+			default:
+				tokens = append(tokens, token{kind: tokenTerm, text: word})
+			}
+			index = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// Recursive descent parser over tokens
+type parser struct {
+	tokens   []token
+	position int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.position >= len(p.tokens) {
+		return token{}, false
+	}
+
+	return p.tokens[p.position], true
+}
+
+// or := and ("OR" and)*
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	var children []*node = []*node{left}
+	for {
+		next, ok := p.peek()
+		if !ok || next.kind != tokenOr {
+			break
+		}
+		p.position++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return left, nil
+	}
+
+	return &node{operator: operatorOr, children: children}, nil
+}
+
+// and := not (["AND"] not)*
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	var children []*node = []*node{left}
+	for {
+		next, ok := p.peek()
+		if !ok || next.kind == tokenOr || next.kind == tokenClose {
+			break
+		}
+		if next.kind == tokenAnd {
+			p.position++
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return left, nil
+	}
+
+	return &node{operator: operatorAnd, children: children}, nil
+}
+
+// not := "NOT" not | "(" or ")" | term
+func (p *parser) parseNot() (*node, error) {
+	next, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	p.position++
+
+	switch next.kind {
+	case tokenNot:
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &node{operator: operatorNot, children: []*node{operand}}, nil
+
+	case tokenOpen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		closing, ok := p.peek()
+		if !ok || closing.kind != tokenClose {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.position++
+		return inner, nil
+
+	case tokenTerm:
+		return &node{term: next.text}, nil
+
+	case tokenClose:
+		return nil, fmt.Errorf("unexpected closing parenthesis")
+
+	default:
+		return nil, fmt.Errorf("operator is missing an operand")
+	}
+}
+
+// Parse boolean query
+func Parse(query string) (*Query, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.position != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected closing parenthesis")
+	}
+
+	return &Query{root: root}, nil
+}
+
+// Evaluate node, collecting found terms that are not negated
+func (n *node) eval(contains func(term string) bool, negated bool, found map[string]bool) bool {
+	switch n.operator {
+	case operatorNot:
+		return !n.children[0].eval(contains, !negated, found)
+
+	case operatorAnd:
+		var matched bool = true
+		for _, child := range n.children {
+			// keep going to record every found term
+			if !child.eval(contains, negated, found) {
+				matched = false
+			}
+		}
+		return matched
+
+	case operatorOr:
+		var matched bool = false
+		for _, child := range n.children {
+			if child.eval(contains, negated, found) {
+				matched = true
+			}
+		}
+		return matched
+
+	default:
+		if contains(n.term) {
+			if !negated {
+				found[n.term] = true
+			}
+			return true
+		}
+		return false
+	}
+}
+
+// Collect terms that are not negated in order of appearance
+func (n *node) terms(negated bool, terms *[]string) {
+	if n.operator == "" {
+		if !negated {
+			*terms = append(*terms, n.term)
+		}
+		return
+	}
+
+	for _, child := range n.children {
+		child.terms(negated != (n.operator == operatorNot), terms)
+	}
+}
+
+// Collect every term in order of appearance
+func (n *node) allTerms(terms *[]string) {
+	if n.operator == "" {
+		*terms = append(*terms, n.term)
+		return
+	}
+
+	for _, child := range n.children {
+		child.allTerms(terms)
+	}
+}
+
+// Get terms that are not negated in order of appearance
+func (q *Query) Terms() []string {
+	var terms []string
+	q.root.terms(false, &terms)
+
+	return terms
+}
+
+// Get every term, negated ones included, in order of appearance
+func (q *Query) AllTerms() []string {
+	var terms []string
+	q.root.allTerms(&terms)
+
+	return terms
+}
+
+// Check whether query matches, using contains to tell whether a term is present.
+// Returns the present terms that are not negated in order of appearance
+func (q *Query) Match(contains func(term string) bool) (bool, []string) {
+	var cache map[string]bool = make(map[string]bool)
+	var cachedContains = func(term string) bool {
+		present, ok := cache[term]
+		if !ok {
+			present = contains(term)
+			cache[term] = present
+		}
+		return present
+	}
+
+	var found map[string]bool = make(map[string]bool)
+	if !q.root.eval(cachedContains, false, found) {
+		return false, nil
+	}
+
+	var terms []string
+	var seen map[string]bool = make(map[string]bool)
+	for _, term := range q.Terms() {
+		if found[term] && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	return true, terms
+}
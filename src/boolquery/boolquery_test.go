@@ -0,0 +1,142 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package boolquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		query   string
+		present []string
+		matched bool
+		found   string
+	}{
+		{"wecr", []string{"wecr"}, true, "wecr"},
+		{"wecr", []string{"crawler"}, false, ""},
+		// implicit AND
+		{"wecr crawler", []string{"wecr"}, false, ""},
+		{"wecr crawler", []string{"crawler", "wecr"}, true, "wecr,crawler"},
+		{"wecr AND crawler", []string{"wecr", "crawler"}, true, "wecr,crawler"},
+		// AND binds tighter than OR
+		{"a OR b AND c", []string{"a"}, true, "a"},
+		{"a OR b AND c", []string{"b"}, false, ""},
+		{"a OR b c", []string{"b", "c"}, true, "b,c"},
+		{"(a OR b) AND c", []string{"a"}, false, ""},
+		{"(a OR b) AND c", []string{"b", "c"}, true, "b,c"},
+		// every present term is recorded, not only the first one
+		{"a OR b", []string{"a", "b"}, true, "a,b"},
+		// NOT
+		{"wecr NOT python", []string{"wecr"}, true, "wecr"},
+		{"wecr NOT python", []string{"wecr", "python"}, false, ""},
+		{"a OR NOT b", []string{"c"}, true, ""},
+		{"NOT NOT a", []string{"a"}, true, "a"},
+		{"NOT (a OR b) c", []string{"c"}, true, "c"},
+		{"NOT (a OR b) c", []string{"b", "c"}, false, ""},
+		// negated terms are not recorded
+		{"a OR NOT b", []string{"a"}, true, "a"},
+		// phrases
+		{`"web scraper" OR crawler`, []string{"web scraper"}, true, "web scraper"},
+		// lower case operators are terms
+		{"a and b", []string{"a", "b", "and"}, true, "a,and,b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query+" on "+strings.Join(test.present, " "), func(t *testing.T) {
+			query, err := Parse(test.query)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+
+			var present map[string]bool = make(map[string]bool)
+			for _, term := range test.present {
+				present[term] = true
+			}
+
+			matched, found := query.Match(func(term string) bool { return present[term] })
+			if matched != test.matched {
+				t.Errorf("expected matched = %v, got %v", test.matched, matched)
+			}
+			if strings.Join(found, ",") != test.found {
+				t.Errorf("expected found terms %q, got %q", test.found, strings.Join(found, ","))
+			}
+		})
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		query    string
+		terms    string
+		allTerms string
+	}{
+		{"a b c", "a,b,c", "a,b,c"},
+		{`a NOT (b OR "c d")`, "a", "a,b,c d"},
+		{"NOT a", "", "a"},
+		{"NOT NOT a", "a", "a"},
+		{"a OR NOT (b NOT c)", "a,c", "a,b,c"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := Parse(test.query)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+
+			terms := strings.Join(query.Terms(), ",")
+			if terms != test.terms {
+				t.Errorf("expected terms %q, got %q", test.terms, terms)
+			}
+
+			allTerms := strings.Join(query.AllTerms(), ",")
+			if allTerms != test.allTerms {
+				t.Errorf("expected all terms %q, got %q", test.allTerms, allTerms)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"a AND",
+		"a OR",
+		"NOT",
+		"AND a",
+		"a OR OR b",
+		"(a OR b",
+		"a OR b)",
+		"()",
+		`"unclosed phrase`,
+		`a ""`,
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			_, err := Parse(test)
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
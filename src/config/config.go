@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"reflect"
 )
 
 const (
@@ -32,6 +33,19 @@ const (
 	QueryDocuments  string = "documents"
 	QueryEverything string = "everything"
 	QueryArchive    string = "archive"
+	QueryMetadata   string = "metadata"
+)
+
+// Queries of text entities. They are prefixed, so plain text queries like "url" or "phone"
+// keep looking for these words
+const (
+	QueryPhone        string = "entity:phone"
+	QueryIP           string = "entity:ip"
+	QueryURL          string = "entity:url"
+	QueryIBAN         string = "entity:iban"
+	QueryCreditCard   string = "entity:credit_card"
+	QueryCryptoWallet string = "entity:crypto_wallet"
+	QuerySocialHandle string = "entity:social_handle"
 )
 
 const (
@@ -43,53 +57,130 @@ const (
 )
 
 type Search struct {
-	IsRegexp bool   `json:"is_regexp"`
-	Query    string `json:"query"`
+	IsRegexp bool   `json:"is_regexp" yaml:"is_regexp" toml:"is_regexp"`
+	Query    string `json:"query" yaml:"query" toml:"query"`
+	// Text query options, see SearchRule
+	IsBoolean     bool `json:"is_boolean" yaml:"is_boolean" toml:"is_boolean"`
+	CaseSensitive bool `json:"case_sensitive" yaml:"case_sensitive" toml:"case_sensitive"`
+	WholeWord     bool `json:"whole_word" yaml:"whole_word" toml:"whole_word"`
+	// Named searches evaluated along with query, see SearchRule
+	Rules []SearchRule `json:"rules" yaml:"rules" toml:"rules"`
+	// What part of the page text and regexp queries are looked for in, see SearchScopeHTML
+	Scope string `json:"scope" yaml:"scope" toml:"scope"`
+	// Characters around text and regexp matches to keep along with their line and nearest heading. 0 keeps none
+	ContextChars uint `json:"context_chars" yaml:"context_chars" toml:"context_chars"`
+	// Structured records to extract from pages
+	Extract Extract `json:"extract" yaml:"extract" toml:"extract"`
+	// Whether to extract page metadata along with whatever is searched for, same as a "metadata" rule
+	Metadata bool `json:"metadata" yaml:"metadata" toml:"metadata"`
+	// How found email addresses are verified, see EmailVerificationMX. Empty is the same as "mx"
+	EmailVerification string `json:"email_verification" yaml:"email_verification" toml:"email_verification"`
 }
 
 type Save struct {
-	OutputDir string `json:"output_dir"`
-	SavePages bool   `json:"save_pages"`
+	OutputDir string `json:"output_dir" yaml:"output_dir" toml:"output_dir"`
+	SavePages bool   `json:"save_pages" yaml:"save_pages" toml:"save_pages"`
 }
 
 type Requests struct {
-	RequestWaitTimeoutMs  uint64 `json:"request_wait_timeout_ms"`
-	RequestPauseMs        uint64 `json:"request_pause_ms"`
-	ContentFetchTimeoutMs uint64 `json:"content_fetch_timeout_ms"`
-	UserAgent             string `json:"user_agent"`
+	RequestWaitTimeoutMs  uint64 `json:"request_wait_timeout_ms" yaml:"request_wait_timeout_ms" toml:"request_wait_timeout_ms"`
+	RequestPauseMs        uint64 `json:"request_pause_ms" yaml:"request_pause_ms" toml:"request_pause_ms"`
+	ContentFetchTimeoutMs uint64 `json:"content_fetch_timeout_ms" yaml:"content_fetch_timeout_ms" toml:"content_fetch_timeout_ms"`
+	UserAgent             string `json:"user_agent" yaml:"user_agent" toml:"user_agent"`
 }
 
 type Logging struct {
-	OutputLogs bool   `json:"output_logs"`
-	LogsFile   string `json:"logs_file"`
+	OutputLogs            bool   `json:"output_logs" yaml:"output_logs" toml:"output_logs"`
+	LogsFile              string `json:"logs_file" yaml:"logs_file" toml:"logs_file"`
+	Level                 string `json:"level" yaml:"level" toml:"level"`
+	Format                string `json:"format" yaml:"format" toml:"format"`
+	RotateSizeMB          uint64 `json:"rotate_size_mb" yaml:"rotate_size_mb" toml:"rotate_size_mb"`
+	RotateIntervalMinutes uint64 `json:"rotate_interval_minutes" yaml:"rotate_interval_minutes" toml:"rotate_interval_minutes"`
+	RotatedFilesKept      uint   `json:"rotated_files_kept" yaml:"rotated_files_kept" toml:"rotated_files_kept"`
+}
+
+// Limits of the whole crawl, zero ones are not enforced. The crawl ends once any of
+// total pages, bytes or duration is exhausted
+type Budget struct {
+	MaxPages           uint64 `json:"max_pages" yaml:"max_pages" toml:"max_pages"`
+	MaxBytes           uint64 `json:"max_bytes" yaml:"max_bytes" toml:"max_bytes"`
+	MaxDurationMinutes uint64 `json:"max_duration_minutes" yaml:"max_duration_minutes" toml:"max_duration_minutes"`
+	// Pages of a single host to visit at most, the rest of them are skipped
+	MaxPagesPerHost uint64 `json:"max_pages_per_host" yaml:"max_pages_per_host" toml:"max_pages_per_host"`
+	// Files of each category (images, videos, audio, documents) to save at most
+	MaxFilesPerCategory uint64 `json:"max_files_per_category" yaml:"max_files_per_category" toml:"max_files_per_category"`
+}
+
+// Near-duplicate page detection by SimHash fingerprints of visible text
+type Duplicates struct {
+	// Whether to skip searching, saving and following links of near-duplicates of visited pages
+	Skip bool `json:"skip" yaml:"skip" toml:"skip"`
+	// Bits out of 64 that fingerprints of near-duplicates differ in at most
+	MaxDistance uint `json:"max_distance" yaml:"max_distance" toml:"max_distance"`
 }
 
 type WebDashboard struct {
-	UseDashboard bool   `json:"launch_dashboard"`
-	Port         uint16 `json:"port"`
+	UseDashboard bool   `json:"launch_dashboard" yaml:"launch_dashboard" toml:"launch_dashboard"`
+	Port         uint16 `json:"port" yaml:"port" toml:"port"`
 }
 
 // Configuration file structure
 type Conf struct {
-	Search             Search       `json:"search"`
-	Requests           Requests     `json:"requests"`
-	Depth              uint         `json:"depth"`
-	Workers            uint         `json:"workers"`
-	InitialPages       []string     `json:"initial_pages"`
-	AllowedDomains     []string     `json:"allowed_domains"`
-	BlacklistedDomains []string     `json:"blacklisted_domains"`
-	InMemoryVisitQueue bool         `json:"in_memory_visit_queue"`
-	Dashboard          WebDashboard `json:"web_dashboard"`
-	Save               Save         `json:"save"`
-	Logging            Logging      `json:"logging"`
+	Version            uint     `json:"version" yaml:"version" toml:"version"`
+	Search             Search   `json:"search" yaml:"search" toml:"search"`
+	Requests           Requests `json:"requests" yaml:"requests" toml:"requests"`
+	Depth              uint     `json:"depth" yaml:"depth" toml:"depth"`
+	Workers            uint     `json:"workers" yaml:"workers" toml:"workers"`
+	InitialPages       []string `json:"initial_pages" yaml:"initial_pages" toml:"initial_pages"`
+	Seeds              Seeds    `json:"seeds" yaml:"seeds" toml:"seeds"`
+	AllowedDomains     []string `json:"allowed_domains" yaml:"allowed_domains" toml:"allowed_domains"`
+	BlacklistedDomains []string `json:"blacklisted_domains" yaml:"blacklisted_domains" toml:"blacklisted_domains"`
+	// Ordered rules deciding which URLs are crawled, see ScopeRule
+	Scope []ScopeRule `json:"scope" yaml:"scope" toml:"scope"`
+	// Which pages are on site, see CrawlModeAny, CrawlModeSameHost and CrawlModeSameDomain
+	CrawlMode string `json:"crawl_mode" yaml:"crawl_mode" toml:"crawl_mode"`
+	// How many links in a row may lead off site, ie: 1 to visit external pages linked from the site without going any further
+	OffsiteHops        uint `json:"offsite_hops" yaml:"offsite_hops" toml:"offsite_hops"`
+	InMemoryVisitQueue bool `json:"in_memory_visit_queue" yaml:"in_memory_visit_queue" toml:"in_memory_visit_queue"`
+	// How often to check configuration file for changes, 0 to only reload on SIGHUP
+	ReloadIntervalMs uint64       `json:"config_reload_interval_ms" yaml:"config_reload_interval_ms" toml:"config_reload_interval_ms"`
+	Dashboard        WebDashboard `json:"web_dashboard" yaml:"web_dashboard" toml:"web_dashboard"`
+	Save             Save         `json:"save" yaml:"save" toml:"save"`
+	Logging          Logging      `json:"logging" yaml:"logging" toml:"logging"`
+	Budget           Budget       `json:"budget" yaml:"budget" toml:"budget"`
+	// Change detection of every job; the crawl ends once there is nothing left to visit
+	Monitor Monitor `json:"monitor" yaml:"monitor" toml:"monitor"`
+	// Near-duplicate detection, each job has its own pages
+	Duplicates Duplicates `json:"duplicates" yaml:"duplicates" toml:"duplicates"`
+	// Named crawls to run concurrently instead of the one described by the top level fields
+	Jobs []Job `json:"jobs" yaml:"jobs" toml:"jobs"`
+
+	// JSON paths of fields that were read but are not a part of configuration
+	unknownFields []string
+	// changes made while upgrading configuration to the current schema version
+	migrations []string
 }
 
 // Default configuration file structure
 func Default() *Conf {
 	return &Conf{
+		Version: CurrentVersion,
 		Search: Search{
-			IsRegexp: false,
-			Query:    "",
+			IsRegexp:      false,
+			Query:         "",
+			IsBoolean:     false,
+			CaseSensitive: false,
+			WholeWord:     false,
+			Rules:         []SearchRule{},
+			Scope:         SearchScopeHTML,
+			ContextChars:  0,
+			Extract: Extract{
+				Container:  "",
+				Fields:     []ExtractField{},
+				OutputFile: "",
+			},
+			Metadata:          false,
+			EmailVerification: EmailVerificationMX,
 		},
 		Save: Save{
 			OutputDir: "scraped",
@@ -101,54 +192,96 @@ func Default() *Conf {
 			RequestPauseMs:        100,
 			ContentFetchTimeoutMs: 0,
 		},
-		InitialPages:       []string{""},
+		InitialPages: []string{""},
+		Seeds: Seeds{
+			Files:            []string{},
+			Sitemaps:         []string{},
+			Feeds:            []string{},
+			DiscoverSitemaps: false,
+		},
 		Depth:              5,
 		Workers:            20,
 		AllowedDomains:     []string{""},
 		BlacklistedDomains: []string{""},
+		Scope:              []ScopeRule{},
+		CrawlMode:          CrawlModeAny,
+		OffsiteHops:        0,
 		InMemoryVisitQueue: false,
+		ReloadIntervalMs:   0,
 		Dashboard: WebDashboard{
 			UseDashboard: true,
 			Port:         13370,
 		},
 		Logging: Logging{
-			OutputLogs: true,
-			LogsFile:   "logs.log",
+			OutputLogs:            true,
+			LogsFile:              "logs.log",
+			Level:                 "info",
+			Format:                "text",
+			RotateSizeMB:          0,
+			RotateIntervalMinutes: 0,
+			RotatedFilesKept:      5,
+		},
+		Budget: Budget{
+			MaxPages:            0,
+			MaxBytes:            0,
+			MaxDurationMinutes:  0,
+			MaxPagesPerHost:     0,
+			MaxFilesPerCategory: 0,
 		},
+		Monitor: Monitor{
+			Enabled:         false,
+			StateFile:       "",
+			OutputFile:      "",
+			IgnoreSelectors: []string{},
+			IgnoreRegexps:   []string{},
+		},
+		Duplicates: Duplicates{
+			Skip:        false,
+			MaxDistance: 3,
+		},
+		Jobs: []Job{},
 	}
 }
 
 // Write current configuration to w
-func (c *Conf) WriteTo(w io.Writer) error {
+func (c *Conf) WriteTo(w io.Writer) (int64, error) {
 	jsonData, err := json.MarshalIndent(c, " ", "\t")
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = w.Write(jsonData)
+	written, err := w.Write(jsonData)
 	if err != nil {
-		return err
+		return int64(written), err
 	}
 
-	return nil
+	return int64(written), nil
 }
 
-// Read configuration from r
-func (c *Conf) ReadFrom(r io.Reader) error {
+// Read configuration from r. Fields that are not a part of configuration are remembered
+// and reported by Validate
+func (c *Conf) ReadFrom(r io.Reader) (int64, error) {
 	jsonData, err := io.ReadAll(r)
 	if err != nil {
-		return nil
+		return int64(len(jsonData)), err
 	}
 
 	err = json.Unmarshal(jsonData, c)
 	if err != nil {
-		return err
+		return int64(len(jsonData)), err
 	}
 
-	return nil
+	var document interface{}
+	err = json.Unmarshal(jsonData, &document)
+	if err != nil {
+		return int64(len(jsonData)), err
+	}
+	c.unknownFields = findUnknownFields(document, reflect.TypeOf(c), "")
+
+	return int64(len(jsonData)), nil
 }
 
-// Creates configuration file at path
+// Creates configuration file at path. Format is picked by file extension (.json, .yaml|.yml, .toml)
 func CreateConfigFile(conf Conf, path string) error {
 	confFile, err := os.Create(path)
 	if err != nil {
@@ -156,7 +289,7 @@ func CreateConfigFile(conf Conf, path string) error {
 	}
 	defer confFile.Close()
 
-	err = conf.WriteTo(confFile)
+	err = conf.Encode(confFile, FormatOf(path))
 	if err != nil {
 		return err
 	}
@@ -164,7 +297,8 @@ func CreateConfigFile(conf Conf, path string) error {
 	return nil
 }
 
-// Tries to open configuration file at path. If it fails - returns default configuration
+// Tries to open configuration file at path. Format is picked by file extension (.json, .yaml|.yml, .toml).
+// If it fails - returns default configuration
 func OpenConfigFile(path string) (*Conf, error) {
 	confFile, err := os.Open(path)
 	if err != nil {
@@ -173,7 +307,7 @@ func OpenConfigFile(path string) (*Conf, error) {
 	defer confFile.Close()
 
 	var conf Conf
-	err = conf.ReadFrom(confFile)
+	err = conf.Decode(confFile, FormatOf(path))
 	if err != nil {
 		return Default(), err
 	}
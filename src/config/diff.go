@@ -0,0 +1,147 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Configuration branches and fields that can be changed while crawling.
+// "[]" stands for any list index
+var liveFields = []string{
+	"search",
+	"requests",
+	"allowed_domains",
+	"blacklisted_domains",
+	"scope",
+	"logging",
+	"jobs[].search",
+	"jobs[].allowed_domains",
+	"jobs[].blacklisted_domains",
+	"jobs[].scope",
+}
+
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// A single changed configuration field
+type Change struct {
+	// JSON path, ie: "search.query"
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// Whether the change can be applied without restarting the crawl
+func (c Change) Live() bool {
+	path := listIndex.ReplaceAllString(c.Path, "[]")
+	for _, liveField := range liveFields {
+		if path == liveField || strings.HasPrefix(path, liveField+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c Change) String() string {
+	oldValue, _ := json.Marshal(c.Old)
+	newValue, _ := json.Marshal(c.New)
+
+	return fmt.Sprintf("%s: %s -> %s", c.Path, oldValue, newValue)
+}
+
+// Find fields that differ between old and new configuration, sorted by path.
+// Lists of objects of the same length are compared element by element, other lists as a whole
+func Diff(old *Conf, new *Conf) []Change {
+	oldDocument, err := toDocument(old)
+	if err != nil {
+		return nil
+	}
+
+	newDocument, err := toDocument(new)
+	if err != nil {
+		return nil
+	}
+
+	var changes []Change = diffDocuments(oldDocument, newDocument, "")
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+// Check whether every element of list is an object
+func isObjectList(list []interface{}) bool {
+	for _, element := range list {
+		if _, ok := element.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func diffDocuments(old map[string]interface{}, new map[string]interface{}, path string) []Change {
+	var keys map[string]bool = make(map[string]bool)
+	for key := range old {
+		keys[key] = true
+	}
+	for key := range new {
+		keys[key] = true
+	}
+
+	var changes []Change
+	for key := range keys {
+		oldObject, oldIsObject := old[key].(map[string]interface{})
+		newObject, newIsObject := new[key].(map[string]interface{})
+		if oldIsObject && newIsObject {
+			changes = append(changes, diffDocuments(oldObject, newObject, joinPath(path, key))...)
+			continue
+		}
+
+		oldList, oldIsList := old[key].([]interface{})
+		newList, newIsList := new[key].([]interface{})
+		if oldIsList && newIsList && len(oldList) == len(newList) && isObjectList(oldList) && isObjectList(newList) {
+			for index := range oldList {
+				changes = append(changes, diffDocuments(
+					oldList[index].(map[string]interface{}),
+					newList[index].(map[string]interface{}),
+					fmt.Sprintf("%s[%d]", joinPath(path, key), index),
+				)...)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(old[key], new[key]) {
+			changes = append(changes, Change{
+				Path: joinPath(path, key),
+				Old:  old[key],
+				New:  new[key],
+			})
+		}
+	}
+
+	return changes
+}
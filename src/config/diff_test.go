@@ -0,0 +1,85 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(conf *Conf)
+		// path of every change, followed by "*" if it can be applied while crawling
+		changes []string
+	}{
+		{"nothing", func(conf *Conf) {}, nil},
+		{"search query", func(conf *Conf) { conf.Search.Query = "crawler" }, []string{"search.query*"}},
+		{"depth and log level", func(conf *Conf) {
+			conf.Depth = 2
+			conf.Logging.Level = "debug"
+		}, []string{"depth", "logging.level*"}},
+		{"list of values as a whole", func(conf *Conf) {
+			conf.InitialPages = append(conf.InitialPages, "https://example.com/")
+		}, []string{"initial_pages"}},
+		{"added jobs as a whole", func(conf *Conf) {
+			conf.Jobs = []Job{{Name: "a", Search: Search{Query: "x"}}, {Name: "b", Search: Search{Query: "y"}}}
+		}, []string{"jobs"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := validConf()
+			new := validConf()
+			test.change(new)
+
+			var changes []string
+			for _, change := range Diff(old, new) {
+				if change.Live() {
+					changes = append(changes, change.Path+"*")
+				} else {
+					changes = append(changes, change.Path)
+				}
+			}
+
+			if strings.Join(changes, ",") != strings.Join(test.changes, ",") {
+				t.Errorf("expected changes %v, got %v", test.changes, changes)
+			}
+		})
+	}
+}
+
+func TestDiffJobs(t *testing.T) {
+	old := validConf()
+	old.Jobs = []Job{{Name: "a", Search: Search{Query: "x"}, Depth: 1}}
+	new := validConf()
+	new.Jobs = []Job{{Name: "a", Search: Search{Query: "y"}, Depth: 2}}
+
+	changes := Diff(old, new)
+	if len(changes) != 2 || changes[0].Path != "jobs[0].depth" || changes[1].Path != "jobs[0].search.query" {
+		t.Fatalf("expected job depth and query to change, got %v", changes)
+	}
+	if changes[0].Live() || !changes[1].Live() {
+		t.Errorf("expected only the job query to be applied while crawling")
+	}
+	if changes[1].String() != `jobs[0].search.query: "x" -> "y"` {
+		t.Errorf("unexpected description: %s", changes[1])
+	}
+}
@@ -0,0 +1,45 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+// Structured data extraction with CSS selectors. Pages are extracted from only if there are fields
+type Extract struct {
+	// Selector of repeated elements (ie: "table.prices tr") each producing its own record.
+	// The whole page produces a single record if empty
+	Container string         `json:"container" yaml:"container" toml:"container"`
+	Fields    []ExtractField `json:"fields" yaml:"fields" toml:"fields"`
+	// File in the output directory to write records to, "found_records.json" if empty
+	OutputFile string `json:"output_file" yaml:"output_file" toml:"output_file"`
+}
+
+// Named value of a record
+type ExtractField struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Selector of the element within container to take value of. Container itself is taken if empty
+	Selector string `json:"selector" yaml:"selector" toml:"selector"`
+	// Attribute to take value of (ie: "href"). Text of the element is taken if empty
+	Attribute string `json:"attribute" yaml:"attribute" toml:"attribute"`
+	// Whether to take values of every matching element as a list instead of the first one
+	All bool `json:"all" yaml:"all" toml:"all"`
+}
+
+// Whether there is anything to extract
+func (e Extract) IsSet() bool {
+	return len(e.Fields) != 0
+}
@@ -0,0 +1,139 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file format
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// Every supported configuration file format
+var Formats = []Format{FormatJSON, FormatYAML, FormatTOML}
+
+// Get format by its name (ie: "yaml" or "yml")
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "toml":
+		return FormatTOML, nil
+	default:
+		return FormatJSON, fmt.Errorf("unknown configuration format \"%s\" (supported: json, yaml, toml)", name)
+	}
+}
+
+// Determine configuration file format by its extension. Files with unknown
+// extensions are treated as JSON
+func FormatOf(path string) Format {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return FormatJSON
+	}
+
+	return format
+}
+
+// Write current configuration to w in given format
+func (c *Conf) Encode(w io.Writer, format Format) error {
+	switch format {
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		err := encoder.Encode(c)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(c)
+
+	default:
+		_, err := c.WriteTo(w)
+		return err
+	}
+}
+
+// Read configuration in given format from r, upgrading it to the current schema version.
+// Documents of every format are checked for unknown fields the same way JSON ones are
+func (c *Conf) Decode(r io.Reader, format Format) error {
+	var document map[string]interface{}
+	switch format {
+	case FormatYAML:
+		err := yaml.NewDecoder(r).Decode(&document)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+	case FormatTOML:
+		_, err := toml.NewDecoder(r).Decode(&document)
+		if err != nil {
+			return err
+		}
+
+	default:
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		err := decoder.Decode(&document)
+		if err != nil {
+			return err
+		}
+	}
+
+	if document == nil {
+		document = make(map[string]interface{})
+	}
+
+	migrations, err := migrate(document)
+	if err != nil {
+		return err
+	}
+
+	// go through JSON so field names, unknown fields and defaults are handled in one place
+	jsonData, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ReadFrom(bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	c.migrations = migrations
+
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import "strings"
+
+// Named crawl that runs alongside the others in the same process. Empty search,
+// zero depth, empty domain lists, scope rules, crawl mode and zero off-site hops are inherited
+// from the top level configuration
+type Job struct {
+	Name               string      `json:"name" yaml:"name" toml:"name"`
+	InitialPages       []string    `json:"initial_pages" yaml:"initial_pages" toml:"initial_pages"`
+	Seeds              Seeds       `json:"seeds" yaml:"seeds" toml:"seeds"`
+	Search             Search      `json:"search" yaml:"search" toml:"search"`
+	Depth              uint        `json:"depth" yaml:"depth" toml:"depth"`
+	AllowedDomains     []string    `json:"allowed_domains" yaml:"allowed_domains" toml:"allowed_domains"`
+	BlacklistedDomains []string    `json:"blacklisted_domains" yaml:"blacklisted_domains" toml:"blacklisted_domains"`
+	Scope              []ScopeRule `json:"scope" yaml:"scope" toml:"scope"`
+	CrawlMode          string      `json:"crawl_mode" yaml:"crawl_mode" toml:"crawl_mode"`
+	OffsiteHops        uint        `json:"offsite_hops" yaml:"offsite_hops" toml:"offsite_hops"`
+	// Subdirectory of save.output_dir for the output of this job. Job name is used if empty
+	OutputDir string `json:"output_dir" yaml:"output_dir" toml:"output_dir"`
+}
+
+// Check whether every entry of list is empty
+func isEmptyList(list []string) bool {
+	for _, entry := range list {
+		if strings.TrimSpace(entry) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get crawl jobs to run with inherited values filled in. If no jobs are defined,
+// the top level configuration is a single job with an empty name and output directory
+func (c *Conf) CrawlJobs() []Job {
+	if len(c.Jobs) == 0 {
+		return []Job{
+			{
+				Name:               "",
+				InitialPages:       c.InitialPages,
+				Seeds:              c.Seeds,
+				Search:             c.Search,
+				Depth:              c.Depth,
+				AllowedDomains:     c.AllowedDomains,
+				BlacklistedDomains: c.BlacklistedDomains,
+				Scope:              c.Scope,
+				CrawlMode:          c.CrawlMode,
+				OffsiteHops:        c.OffsiteHops,
+				OutputDir:          "",
+			},
+		}
+	}
+
+	var jobs []Job
+	for _, job := range c.Jobs {
+		if !job.Search.IsSet() {
+			job.Search = c.Search
+		}
+		if job.Depth == 0 {
+			job.Depth = c.Depth
+		}
+		if c.Seeds.DiscoverSitemaps {
+			job.Seeds.DiscoverSitemaps = true
+		}
+		if isEmptyList(job.AllowedDomains) {
+			job.AllowedDomains = c.AllowedDomains
+		}
+		if isEmptyList(job.BlacklistedDomains) {
+			job.BlacklistedDomains = c.BlacklistedDomains
+		}
+		if len(job.Scope) == 0 {
+			job.Scope = c.Scope
+		}
+		if job.CrawlMode == "" {
+			job.CrawlMode = c.CrawlMode
+		}
+		if job.OffsiteHops == 0 {
+			job.OffsiteHops = c.OffsiteHops
+		}
+		if job.OutputDir == "" {
+			job.OutputDir = job.Name
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
@@ -0,0 +1,359 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Upgrades configuration document of one schema version to the next one.
+// Returns human-readable descriptions of every change made
+type migration func(document map[string]interface{}) []string
+
+// Migrations in order: migrations[N] upgrades version N to version N+1.
+// Documents without "version" field are of version 0
+var migrations = []migration{
+	migrateUnversioned,
+	migrateCrawlMode,
+	migrateSeeds,
+	migrateSearchRules,
+	migrateMatchContext,
+	migrateSearchScope,
+	migrateTextMatching,
+	migrateExtract,
+	migrateMetadata,
+	migrateEmailVerification,
+	migrateMonitor,
+	migrateDuplicates,
+}
+
+// Current configuration schema version. Bump along with adding a migration that fills
+// fields added since the previous version with their defaults of that time
+const CurrentVersion uint = 12
+
+// Defaults of every field of version 1. Frozen: fields added later are filled by later migrations
+const defaultsV1 string = `{
+	"search": {"is_regexp": false, "query": ""},
+	"requests": {"request_wait_timeout_ms": 2500, "request_pause_ms": 100, "content_fetch_timeout_ms": 0, "user_agent": ""},
+	"depth": 5,
+	"workers": 20,
+	"initial_pages": [""],
+	"allowed_domains": [""],
+	"blacklisted_domains": [""],
+	"in_memory_visit_queue": false,
+	"web_dashboard": {"launch_dashboard": true, "port": 13370},
+	"save": {"output_dir": "scraped", "save_pages": false},
+	"logging": {
+		"output_logs": true, "logs_file": "logs.log", "level": "info", "format": "text",
+		"rotate_size_mb": 0, "rotate_interval_minutes": 0, "rotated_files_kept": 5
+	}
+}`
+
+// Defaults of fields added in version 2. Frozen
+const defaultsV2 string = `{
+	"config_reload_interval_ms": 0,
+	"jobs": [],
+	"scope": [],
+	"budget": {
+		"max_pages": 0, "max_bytes": 0, "max_duration_minutes": 0,
+		"max_pages_per_host": 0, "max_files_per_category": 0
+	},
+	"crawl_mode": "any",
+	"offsite_hops": 0
+}`
+
+// Defaults of fields added in version 3. Frozen
+const defaultsV3 string = `{
+	"seeds": {"files": [], "sitemaps": [], "feeds": [], "discover_sitemaps": false}
+}`
+
+// Defaults of fields added in version 4. Frozen
+const defaultsV4 string = `{
+	"search": {"rules": []}
+}`
+
+// Defaults of fields added in version 5. Frozen
+const defaultsV5 string = `{
+	"search": {"context_chars": 0}
+}`
+
+// Defaults of fields added in version 6. Frozen
+const defaultsV6 string = `{
+	"search": {"scope": "html"}
+}`
+
+// Defaults of fields added in version 7. Frozen
+const defaultsV7 string = `{
+	"search": {"is_boolean": false, "case_sensitive": false, "whole_word": false}
+}`
+
+// Defaults of fields added in version 8. Frozen
+const defaultsV8 string = `{
+	"search": {"extract": {"container": "", "fields": [], "output_file": ""}}
+}`
+
+// Defaults of fields added in version 9. Frozen
+const defaultsV9 string = `{
+	"search": {"metadata": false}
+}`
+
+// Defaults of fields added in version 10. Frozen
+const defaultsV10 string = `{
+	"search": {"email_verification": "mx"}
+}`
+
+// Defaults of fields added in version 11. Frozen
+const defaultsV11 string = `{
+	"monitor": {"enabled": false, "state_file": "", "output_file": "", "ignore_selectors": [], "ignore_regexps": []}
+}`
+
+// Defaults of fields added in version 12. Frozen
+const defaultsV12 string = `{
+	"duplicates": {"skip": false, "max_distance": 3}
+}`
+
+// Decode frozen defaults of a schema version
+func frozenDefaults(defaults string) map[string]interface{} {
+	var document map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(defaults))
+	decoder.UseNumber()
+	err := decoder.Decode(&document)
+	if err != nil {
+		panic(fmt.Sprintf("invalid frozen configuration defaults: %s", err))
+	}
+
+	return document
+}
+
+// Version 0 -> 1: files written before configuration was versioned. Fields that were
+// added over time (ie: in_memory_visit_queue in v0.2.4, web_dashboard, logging level and
+// rotation) were silently zeroed when missing; now they get their default values
+func migrateUnversioned(document map[string]interface{}) []string {
+	var changes []string
+
+	// results are written to found_text.json and found_emails.json instead
+	if save, ok := document["save"].(map[string]interface{}); ok {
+		if _, ok := save["output_file"]; ok {
+			delete(save, "output_file")
+			changes = append(changes, "removed save.output_file: results are written to their own files in the working directory")
+		}
+	}
+
+	changes = append(changes, addMissing(document, frozenDefaults(defaultsV1), "")...)
+
+	return changes
+}
+
+// Version 1 -> 2: crawl_mode and offsite_hops were added, as well as jobs, scope rules,
+// config reload interval and budget. Empty crawl mode is not valid, so add the defaults
+func migrateCrawlMode(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV2), "")
+}
+
+// Version 2 -> 3: seed files, sitemaps and feeds were added
+func migrateSeeds(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV3), "")
+}
+
+// Version 3 -> 4: named search rules were added
+func migrateSearchRules(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV4), "")
+}
+
+// Version 4 -> 5: match context was added
+func migrateMatchContext(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV5), "")
+}
+
+// Version 5 -> 6: search scope was added. Empty scope is not valid, so add the default
+func migrateSearchScope(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV6), "")
+}
+
+// Version 6 -> 7: boolean, case-sensitive and whole-word text queries were added
+func migrateTextMatching(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV7), "")
+}
+
+// Version 7 -> 8: extraction of records was added
+func migrateExtract(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV8), "")
+}
+
+// Version 8 -> 9: metadata of pages was added
+func migrateMetadata(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV9), "")
+}
+
+// Version 9 -> 10: email verification was made configurable. Addresses were checked for MX records before, so keep doing that
+func migrateEmailVerification(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV10), "")
+}
+
+// Version 10 -> 11: change detection was added
+func migrateMonitor(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV11), "")
+}
+
+// Version 11 -> 12: skipping of near-duplicates was added. Distance is not zero by default
+func migrateDuplicates(document map[string]interface{}) []string {
+	return addMissing(document, frozenDefaults(defaultsV12), "")
+}
+
+// Convert configuration to a generic document
+func toDocument(conf *Conf) (map[string]interface{}, error) {
+	jsonData, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	err = decoder.Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// Add fields of defaults that are missing from document, going into nested objects
+func addMissing(document map[string]interface{}, defaults map[string]interface{}, path string) []string {
+	var keys []string
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, key := range keys {
+		value, ok := document[key]
+		if !ok {
+			document[key] = defaults[key]
+			defaultValue, _ := json.Marshal(defaults[key])
+			changes = append(changes, fmt.Sprintf("added %s = %s", joinPath(path, key), defaultValue))
+			continue
+		}
+
+		nestedDocument, documentIsObject := value.(map[string]interface{})
+		nestedDefaults, defaultsIsObject := defaults[key].(map[string]interface{})
+		if documentIsObject && defaultsIsObject {
+			changes = append(changes, addMissing(nestedDocument, nestedDefaults, joinPath(path, key))...)
+		}
+	}
+
+	return changes
+}
+
+// Get schema version of configuration document
+func documentVersion(document map[string]interface{}) (uint, error) {
+	rawVersion, ok := document["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	var version uint
+	jsonVersion, _ := json.Marshal(rawVersion)
+	err := json.Unmarshal(jsonVersion, &version)
+	if err != nil {
+		return 0, fmt.Errorf("invalid configuration version %s", jsonVersion)
+	}
+
+	return version, nil
+}
+
+// Upgrade configuration document to the current schema version. Documents of newer
+// versions are left as is for Validate to report. Returns descriptions of every change made
+func migrate(document map[string]interface{}) ([]string, error) {
+	version, err := documentVersion(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	var initialVersion uint = version
+	for ; version < CurrentVersion && version < uint(len(migrations)); version++ {
+		for _, change := range migrations[version](document) {
+			changes = append(changes, fmt.Sprintf("v%d -> v%d: %s", version, version+1, change))
+		}
+		document["version"] = version + 1
+	}
+
+	if version != initialVersion {
+		changes = append(changes, fmt.Sprintf("set version = %d", version))
+	}
+
+	return changes, nil
+}
+
+// Get descriptions of changes made while upgrading configuration to the current schema version.
+// Empty if configuration was already up to date
+func (c *Conf) Migrations() []string {
+	return c.migrations
+}
+
+// Upgrade configuration file at path to the current schema version, rewriting it in place.
+// Original file is kept as backupPath. Nothing is written if the file is already up to date
+func MigrateConfigFile(path string) (changes []string, backupPath string, err error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var conf Conf
+	err = conf.Decode(bytes.NewReader(original), FormatOf(path))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if conf.Version > CurrentVersion {
+		return nil, "", fmt.Errorf(
+			"configuration version %d is newer than the supported %d", conf.Version, CurrentVersion,
+		)
+	}
+
+	changes = conf.Migrations()
+	// unknown fields can not be written back
+	for _, unknownField := range conf.unknownFields {
+		changes = append(changes, fmt.Sprintf("removed unknown field %s", unknownField))
+	}
+
+	if len(changes) == 0 {
+		return nil, "", nil
+	}
+
+	backupPath = path + ".bak"
+	err = os.WriteFile(backupPath, original, 0644)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = CreateConfigFile(conf, path)
+	if err != nil {
+		return nil, backupPath, err
+	}
+
+	return changes, backupPath, nil
+}
@@ -0,0 +1,126 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		check    func(conf *Conf) bool
+		change   string
+	}{
+		{
+			"unversioned gets v1 defaults",
+			`{"search": {"query": "wecr"}, "initial_pages": ["https://example.org/"], "depth": 1, "workers": 1}`,
+			func(conf *Conf) bool {
+				return conf.Dashboard.Port == 13370 && conf.Logging.Level == "info" && conf.Logging.RotatedFilesKept == 5
+			},
+			"v0 -> v1: added web_dashboard = ",
+		},
+		{
+			"unversioned loses save.output_file",
+			`{"search": {"query": "wecr"}, "save": {"output_file": "found.json"}}`,
+			func(conf *Conf) bool { return conf.Save.OutputDir == "scraped" && len(conf.unknownFields) == 0 },
+			"v0 -> v1: removed save.output_file",
+		},
+		{
+			"v1 gets crawl mode",
+			`{"version": 1, "search": {"query": "wecr"}}`,
+			func(conf *Conf) bool { return conf.CrawlMode == "any" },
+			"v1 -> v2: added crawl_mode = \"any\"",
+		},
+		{
+			"v2 keeps set fields",
+			`{"version": 2, "crawl_mode": "same_host", "search": {"query": "wecr"}, "duplicates": {"skip": true}}`,
+			func(conf *Conf) bool {
+				return conf.CrawlMode == "same_host" && conf.Duplicates.Skip && conf.Duplicates.MaxDistance == 3
+			},
+			"added duplicates.max_distance = 3",
+		},
+		{
+			"v2 gets email verification",
+			`{"version": 2, "crawl_mode": "any", "search": {"query": "wecr"}}`,
+			func(conf *Conf) bool { return conf.Search.EmailVerification == "mx" },
+			"added search.email_verification = \"mx\"",
+		},
+		{
+			"current version is left as is",
+			fmt.Sprintf(`{"version": %d, "crawl_mode": "any", "search": {"query": "wecr"}}`, CurrentVersion),
+			func(conf *Conf) bool { return len(conf.Migrations()) == 0 && conf.Duplicates.MaxDistance == 0 },
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var conf Conf
+			err := conf.Decode(strings.NewReader(test.document), FormatJSON)
+			if err != nil {
+				t.Fatalf("failed to decode: %s", err)
+			}
+
+			if conf.Version != CurrentVersion {
+				t.Errorf("expected version %d, got %d", CurrentVersion, conf.Version)
+			}
+
+			if !test.check(&conf) {
+				t.Errorf("unexpected migrated configuration: %+v", conf)
+			}
+
+			if test.change == "" {
+				return
+			}
+			for _, change := range conf.Migrations() {
+				if strings.Contains(change, test.change) {
+					return
+				}
+			}
+			t.Errorf("expected change %q, got %v", test.change, conf.Migrations())
+		})
+	}
+}
+
+// Every field of the current configuration must be filled by some migration,
+// otherwise adding a field without bumping the schema version goes unnoticed
+func TestMigrationsCoverConf(t *testing.T) {
+	if uint(len(migrations)) != CurrentVersion {
+		t.Fatalf("expected %d migrations up to version %d, got %d", CurrentVersion, CurrentVersion, len(migrations))
+	}
+
+	current, err := toDocument(Default())
+	if err != nil {
+		t.Fatalf("failed to convert defaults: %s", err)
+	}
+
+	migrated := map[string]interface{}{}
+	_, err = migrate(migrated)
+	if err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+
+	for _, missing := range addMissing(migrated, current, "") {
+		t.Errorf("field is not filled by any migration: %s", missing)
+	}
+}
@@ -0,0 +1,33 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+// Change detection: pages are compared against the ones of the previous crawl
+type Monitor struct {
+	Enabled bool `json:"enabled" yaml:"enabled" toml:"enabled"`
+	// File in the output directory of each job keeping page hashes and texts between crawls,
+	// "monitor_state.json" if empty
+	StateFile string `json:"state_file" yaml:"state_file" toml:"state_file"`
+	// File in the output directory of each job to write changes to, "changes.jsonl" if empty
+	OutputFile string `json:"output_file" yaml:"output_file" toml:"output_file"`
+	// Elements that are removed before comparing pages (ie: ".ad", "#clock")
+	IgnoreSelectors []string `json:"ignore_selectors" yaml:"ignore_selectors" toml:"ignore_selectors"`
+	// Text that is removed before comparing pages (ie: timestamps)
+	IgnoreRegexps []string `json:"ignore_regexps" yaml:"ignore_regexps" toml:"ignore_regexps"`
+}
@@ -0,0 +1,375 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix of environment variables that override configuration fields
+const EnvPrefix string = "WECR_"
+
+// Short command-line flag names for the most used configuration fields
+var flagAliases = map[string]string{
+	"query":      "search.query",
+	"regexp":     "search.is_regexp",
+	"seed":       "initial_pages",
+	"seed-file":  "seeds.files",
+	"sitemap":    "seeds.sitemaps",
+	"feed":       "seeds.feeds",
+	"allow":      "allowed_domains",
+	"block":      "blacklisted_domains",
+	"output":     "save.output_dir",
+	"user-agent": "requests.user_agent",
+	"port":       "web_dashboard.port",
+}
+
+// Fields that are not meant to be overridden
+var notOverridable = map[string]bool{
+	"version": true,
+}
+
+// Leaf field of configuration that can be overridden
+type Field struct {
+	// JSON path, ie: "search.query"
+	Path string
+	Type reflect.Type
+}
+
+// Get every leaf field of configuration
+func Fields() []Field {
+	return fieldsOf(reflect.TypeOf(Conf{}), "")
+}
+
+func fieldsOf(t reflect.Type, prefix string) []Field {
+	var fields []Field
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := jsonName(field)
+		if name == "-" || notOverridable[joinPath(prefix, name)] {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			fields = append(fields, fieldsOf(field.Type, joinPath(prefix, name))...)
+			continue
+		}
+
+		fields = append(fields, Field{
+			Path: joinPath(prefix, name),
+			Type: field.Type,
+		})
+	}
+
+	return fields
+}
+
+// Get the name structure field has in JSON
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// Get the name of environment variable that overrides field at path, ie: "WECR_SEARCH_QUERY"
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// Find the value of field at JSON path
+func (c *Conf) fieldValue(path string) (reflect.Value, error) {
+	value := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(path, ".") {
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown field \"%s\"", path)
+		}
+
+		var found bool = false
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.IsExported() && jsonName(field) == name {
+				value = value.Field(i)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown field \"%s\"", path)
+		}
+	}
+
+	return value, nil
+}
+
+// Parse raw into value according to its type. Lists of strings can be either
+// comma-separated or JSON arrays, anything more complex is expected to be JSON
+func setValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("\"%s\" is not a boolean", raw)
+		}
+		value.SetBool(parsed)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(strings.TrimSpace(raw), 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("\"%s\" is not a valid unsigned number", raw)
+		}
+		value.SetUint(parsed)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(raw), 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("\"%s\" is not a valid number", raw)
+		}
+		value.SetInt(parsed)
+
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(raw), value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("\"%s\" is not a valid number", raw)
+		}
+		value.SetFloat(parsed)
+
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			var list []string
+			for _, entry := range strings.Split(raw, ",") {
+				if strings.TrimSpace(entry) != "" {
+					list = append(list, strings.TrimSpace(entry))
+				}
+			}
+			value.Set(reflect.ValueOf(list))
+			break
+		}
+		fallthrough
+
+	default:
+		newValue := reflect.New(value.Type())
+		err := json.Unmarshal([]byte(raw), newValue.Interface())
+		if err != nil {
+			return fmt.Errorf("invalid JSON value: %s", err)
+		}
+		value.Set(newValue.Elem())
+	}
+
+	return nil
+}
+
+// Set field at JSON path from its textual representation
+func (c *Conf) Set(path string, raw string) error {
+	value, err := c.fieldValue(path)
+	if err != nil {
+		return err
+	}
+
+	err = setValue(value, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Override configuration fields with WECR_* environment variables from environ ("KEY=value" pairs).
+// Reports every unknown variable and invalid value at once
+func (c *Conf) ApplyEnv(environ []string) error {
+	var paths map[string]string = make(map[string]string)
+	for _, field := range Fields() {
+		paths[EnvName(field.Path)] = field.Path
+	}
+
+	var problems ValidationErrors
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, EnvPrefix) {
+			continue
+		}
+
+		name, value, _ := strings.Cut(variable, "=")
+		path, ok := paths[name]
+		if !ok {
+			problems = append(problems, ValidationError{
+				Path:    name,
+				Message: "environment variable does not match any configuration field",
+			})
+			continue
+		}
+
+		fieldValue, _ := c.fieldValue(path)
+		err := setValue(fieldValue, value)
+		if err != nil {
+			problems = append(problems, ValidationError{
+				Path:    name,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return problems
+}
+
+// Check whether environ has any WECR_* variables
+func HasEnvOverrides(environ []string) bool {
+	for _, variable := range environ {
+		if strings.HasPrefix(variable, EnvPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Configuration values given via command-line flags
+type FlagOverrides struct {
+	// last value of every scalar field
+	values map[string]string
+	// every value of list fields in the order they were given
+	lists map[string][]string
+	// order in which fields were first given
+	order []string
+}
+
+// A command-line flag that sets a single configuration field
+type overrideFlag struct {
+	overrides *FlagOverrides
+	field     Field
+}
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(value string) error {
+	// check the value early so the error is reported along with the flag name
+	err := setValue(reflect.New(f.field.Type).Elem(), value)
+	if err != nil {
+		return err
+	}
+
+	o := f.overrides
+	_, scalarSeen := o.values[f.field.Path]
+	_, listSeen := o.lists[f.field.Path]
+	if !scalarSeen && !listSeen {
+		o.order = append(o.order, f.field.Path)
+	}
+
+	if f.isList() {
+		o.lists[f.field.Path] = append(o.lists[f.field.Path], value)
+	} else {
+		o.values[f.field.Path] = value
+	}
+
+	return nil
+}
+
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.field.Type.Kind() == reflect.Bool
+}
+
+// Whether the flag can be repeated to add several values to a list of strings
+func (f *overrideFlag) isList() bool {
+	return f.field.Type.Kind() == reflect.Slice && f.field.Type.Elem().Kind() == reflect.String
+}
+
+// Register a flag for every configuration field on flagSet, named after its JSON path
+// (ie: -search.query or -depth) as well as short aliases such as -query, -seed and -allow
+func (o *FlagOverrides) Register(flagSet *flag.FlagSet) {
+	o.values = make(map[string]string)
+	o.lists = make(map[string][]string)
+
+	var fieldsByPath map[string]Field = make(map[string]Field)
+	for _, field := range Fields() {
+		fieldsByPath[field.Path] = field
+
+		var usage string = fmt.Sprintf("Override \"%s\" configuration field", field.Path)
+		if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String {
+			usage += " (can be repeated)"
+		}
+
+		flagSet.Var(&overrideFlag{
+			overrides: o,
+			field:     field,
+		}, field.Path, usage)
+	}
+
+	var aliases []string
+	for alias := range flagAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		field := fieldsByPath[flagAliases[alias]]
+		flagSet.Var(&overrideFlag{
+			overrides: o,
+			field:     field,
+		}, alias, fmt.Sprintf("Same as -%s", field.Path))
+	}
+}
+
+// Check whether any configuration field has been given via flags
+func (o *FlagOverrides) Empty() bool {
+	return len(o.order) == 0
+}
+
+// Override configuration fields with values given via flags. Repeated list flags
+// replace the whole list
+func (o *FlagOverrides) Apply(c *Conf) error {
+	for _, path := range o.order {
+		value, err := c.fieldValue(path)
+		if err != nil {
+			return err
+		}
+
+		if list, ok := o.lists[path]; ok {
+			value.Set(reflect.ValueOf(list))
+			continue
+		}
+
+		err = setValue(value, o.values[path])
+		if err != nil {
+			return fmt.Errorf("-%s: %s", path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+const (
+	ScopeAllow string = "allow"
+	ScopeDeny  string = "deny"
+)
+
+// Which pages are considered on site relative to the initial page a visit originated from
+const (
+	// Any page in scope
+	CrawlModeAny string = "any"
+	// Pages on the same host as the initial page
+	CrawlModeSameHost string = "same_host"
+	// Pages on the same registrable domain as the initial page (ie: "en.wikipedia.org" and "de.wikipedia.org")
+	CrawlModeSameDomain string = "same_domain"
+)
+
+var crawlModes = []string{CrawlModeAny, CrawlModeSameHost, CrawlModeSameDomain}
+
+// Rule deciding whether URLs are crawled. A rule matches a URL when every one of its
+// non-empty conditions does; the first matching rule decides
+type ScopeRule struct {
+	// "allow" or "deny"
+	Action string `json:"action" yaml:"action" toml:"action"`
+	// Host pattern where "*" stands for any sequence of characters (ie: "*.wikipedia.org").
+	// Port is ignored unless the pattern has one (ie: "localhost:8080")
+	Host string `json:"host" yaml:"host" toml:"host"`
+	// Whether subdomains of Host match as well
+	IncludeSubdomains bool `json:"include_subdomains" yaml:"include_subdomains" toml:"include_subdomains"`
+	// Beginning of URL path (ie: "/wiki/")
+	PathPrefix string `json:"path_prefix" yaml:"path_prefix" toml:"path_prefix"`
+	// Regular expression the whole URL has to match
+	Regexp string `json:"regexp" yaml:"regexp" toml:"regexp"`
+}
@@ -0,0 +1,123 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import "strings"
+
+// What part of a page text and regexp queries are looked for in
+const (
+	// Raw page markup
+	SearchScopeHTML string = "html"
+	// Text of the page as a reader sees it
+	SearchScopeText string = "text"
+	// Page title
+	SearchScopeTitle string = "title"
+	// Page URL
+	SearchScopeURL string = "url"
+)
+
+var searchScopes = []string{SearchScopeHTML, SearchScopeText, SearchScopeTitle, SearchScopeURL}
+
+// How found email addresses are verified
+const (
+	// Every address that looks like one is kept
+	EmailVerificationNone string = "none"
+	// Addresses must be syntactically valid
+	EmailVerificationSyntax string = "syntax"
+	// Domains of valid addresses must have MX records, looked up once per domain
+	EmailVerificationMX string = "mx"
+)
+
+var emailVerifications = []string{EmailVerificationNone, EmailVerificationSyntax, EmailVerificationMX}
+
+// Named search evaluated on every visited page along with the others
+type SearchRule struct {
+	Name     string `json:"name" yaml:"name" toml:"name"`
+	IsRegexp bool   `json:"is_regexp" yaml:"is_regexp" toml:"is_regexp"`
+	// Text, regexp or one of the special queries (ie: "email", "images")
+	Query string `json:"query" yaml:"query" toml:"query"`
+	// Whether text query is a boolean one with AND, OR, NOT, parentheses and quoted phrases
+	IsBoolean bool `json:"is_boolean" yaml:"is_boolean" toml:"is_boolean"`
+	// Whether text query letter case matters
+	CaseSensitive bool `json:"case_sensitive" yaml:"case_sensitive" toml:"case_sensitive"`
+	// Whether text query terms must not be parts of longer words
+	WholeWord bool `json:"whole_word" yaml:"whole_word" toml:"whole_word"`
+	// File in the output directory to write results of this rule to instead of the common one
+	OutputFile string `json:"output_file" yaml:"output_file" toml:"output_file"`
+	// What part of the page to look in, search scope is used if empty
+	Scope string `json:"scope" yaml:"scope" toml:"scope"`
+}
+
+// Whether there is anything to search for or extract
+func (s Search) IsSet() bool {
+	return s.Query != "" || len(s.Rules) != 0 || s.Extract.IsSet() || s.Metadata
+}
+
+// Get every search rule: query, if set, as an unnamed rule followed by named rules and, if metadata
+// is to be extracted and none of them does that, an unnamed metadata rule
+func (s Search) AllRules() []SearchRule {
+	var rules []SearchRule
+	if s.Query != "" {
+		rules = append(rules, SearchRule{
+			Name:          "",
+			IsRegexp:      s.IsRegexp,
+			Query:         s.Query,
+			IsBoolean:     s.IsBoolean,
+			CaseSensitive: s.CaseSensitive,
+			WholeWord:     s.WholeWord,
+		})
+	}
+	rules = append(rules, s.Rules...)
+
+	if s.Metadata {
+		var hasMetadataRule bool = false
+		for _, rule := range rules {
+			if rule.Query == QueryMetadata {
+				hasMetadataRule = true
+				break
+			}
+		}
+		if !hasMetadataRule {
+			rules = append(rules, SearchRule{Name: "", Query: QueryMetadata})
+		}
+	}
+
+	for index := range rules {
+		if rules[index].Scope == "" {
+			rules[index].Scope = s.Scope
+		}
+		if rules[index].Scope == "" {
+			rules[index].Scope = SearchScopeHTML
+		}
+		rules[index].Scope = strings.ToLower(strings.TrimSpace(rules[index].Scope))
+	}
+
+	return rules
+}
+
+// Whether any of the search rules has query
+func (s Search) HasQuery(query string) bool {
+	for _, rule := range s.AllRules() {
+		if rule.Query == query {
+			return true
+		}
+	}
+
+	return false
+}
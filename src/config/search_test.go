@@ -0,0 +1,69 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		search Search
+		// name:query:scope of every rule
+		rules []string
+	}{
+		{"empty", Search{}, nil},
+		{"query only", Search{Query: "wecr"}, []string{":wecr:html"}},
+		{
+			"query goes first",
+			Search{Query: "wecr", Scope: SearchScopeText, Rules: []SearchRule{{Name: "mail", Query: QueryEmail}}},
+			[]string{":wecr:text", "mail:email:text"},
+		},
+		{
+			"rule scope overrides search scope",
+			Search{Scope: SearchScopeText, Rules: []SearchRule{{Name: "a", Query: "b", Scope: " Title "}}},
+			[]string{"a:b:title"},
+		},
+		{
+			"metadata is added",
+			Search{Query: "wecr", Metadata: true},
+			[]string{":wecr:html", ":metadata:html"},
+		},
+		{
+			"metadata is not added twice",
+			Search{Metadata: true, Rules: []SearchRule{{Name: "meta", Query: QueryMetadata}}},
+			[]string{"meta:metadata:html"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var rules []string
+			for _, rule := range test.search.AllRules() {
+				rules = append(rules, rule.Name+":"+rule.Query+":"+rule.Scope)
+			}
+
+			if strings.Join(rules, ",") != strings.Join(test.rules, ",") {
+				t.Errorf("expected rules %v, got %v", test.rules, rules)
+			}
+		})
+	}
+}
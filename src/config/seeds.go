@@ -0,0 +1,39 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+// Seed file path that stands for standard input
+const SeedsStdin string = "-"
+
+// Sources of initial pages besides initial_pages
+type Seeds struct {
+	// Files with a URL per line. "-" reads URLs from standard input
+	Files []string `json:"files" yaml:"files" toml:"files"`
+	// URLs of sitemaps or sitemap indexes, gzipped ones included
+	Sitemaps []string `json:"sitemaps" yaml:"sitemaps" toml:"sitemaps"`
+	// URLs of RSS or Atom feeds
+	Feeds []string `json:"feeds" yaml:"feeds" toml:"feeds"`
+	// Whether to use sitemaps announced in robots.txt of initial pages' hosts
+	DiscoverSitemaps bool `json:"discover_sitemaps" yaml:"discover_sitemaps" toml:"discover_sitemaps"`
+}
+
+// Whether any seed source besides robots.txt is set
+func (s Seeds) hasSources() bool {
+	return !isEmptyList(s.Files) || !isEmptyList(s.Sitemaps) || !isEmptyList(s.Feeds)
+}
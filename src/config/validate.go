@@ -0,0 +1,631 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unbewohnte/wecr/boolquery"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// Lowest content fetch timeout that still gives files a chance to be downloaded
+const minContentFetchTimeoutMs uint64 = 1000
+
+// Largest number of bits SimHash fingerprints of near-duplicates may differ in
+const maxDuplicateDistance uint = 16
+
+var logLevels = []string{"", "debug", "info", "warning", "warn", "error"}
+var logFormats = []string{"", "text", "json"}
+
+// A single problem with configuration
+type ValidationError struct {
+	// JSON path to the problematic value, ie: "search.query" or "initial_pages[1]"
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Every problem found in configuration
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	var messages []string
+	for _, validationError := range e {
+		messages = append(messages, validationError.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Check whether query is one of the special values
+func IsSpecialQuery(query string) bool {
+	switch query {
+	case QueryImages, QueryVideos, QueryAudio, QueryEmail, QueryDocuments, QueryEverything, QueryArchive, QueryMetadata:
+		return true
+	default:
+		return IsEntityQuery(query)
+	}
+}
+
+// Check whether query is one of the text entities (ie: "entity:phone", "entity:iban")
+func IsEntityQuery(query string) bool {
+	switch query {
+	case QueryPhone, QueryIP, QueryURL, QueryIBAN, QueryCreditCard, QueryCryptoWallet, QuerySocialHandle:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check whether query makes workers download files
+func IsFileQuery(query string) bool {
+	switch query {
+	case QueryImages, QueryVideos, QueryAudio, QueryDocuments, QueryEverything:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check whether value is one of allowed (case-insensitive)
+func oneOf(value string, allowed []string) bool {
+	for _, allowedValue := range allowed {
+		if strings.EqualFold(strings.TrimSpace(value), allowedValue) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse rawURL and make sure it is an absolute http(s) URL, as initial pages must be
+func ParseAbsoluteURL(rawURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsedURL.Scheme == "" {
+		return nil, fmt.Errorf("no scheme specified (ie: https://%s)", rawURL)
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme \"%s\"", parsedURL.Scheme)
+	}
+
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("no host specified")
+	}
+
+	return parsedURL, nil
+}
+
+// Remember a problem with value at path
+func (e *ValidationErrors) add(path string, format string, a ...interface{}) {
+	*e = append(*e, ValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// Check a single search query at path
+func (e *ValidationErrors) checkQuery(path string, isRegexp bool, isBoolean bool, query string, requests Requests) {
+	if query == "" {
+		e.add(joinPath(path, "query"), "search query has not been set")
+	} else if IsSpecialQuery(query) {
+		if isRegexp {
+			e.add(joinPath(path, "is_regexp"), "\"%s\" is a special query and can not be treated as a regexp", query)
+		}
+		if isBoolean {
+			e.add(joinPath(path, "is_boolean"), "\"%s\" is a special query and can not be treated as a boolean one", query)
+		}
+	} else if isRegexp && isBoolean {
+		e.add(joinPath(path, "is_boolean"), "query can not be both a regexp and a boolean one")
+	} else if isBoolean {
+		parsed, err := boolquery.Parse(query)
+		if err != nil {
+			e.add(joinPath(path, "query"), "invalid boolean query: %s", err)
+		} else if len(parsed.Terms()) == 0 {
+			e.add(joinPath(path, "query"), "boolean query only excludes terms and would match every page without them")
+		}
+	} else if isRegexp {
+		_, err := regexp.Compile(query)
+		if err != nil {
+			e.add(joinPath(path, "query"), "invalid regexp: %s", err)
+		}
+	}
+
+	if IsFileQuery(query) &&
+		requests.ContentFetchTimeoutMs != 0 &&
+		requests.ContentFetchTimeoutMs < minContentFetchTimeoutMs {
+		e.add(
+			"requests.content_fetch_timeout_ms",
+			"%d is too low for \"%s\" query to fetch files; set to 0 to wait for files to load fully",
+			requests.ContentFetchTimeoutMs, query,
+		)
+	}
+}
+
+// Check search settings at path
+func (e *ValidationErrors) checkSearch(path string, search Search, requests Requests) {
+	if !search.IsSet() {
+		e.add(joinPath(path, "query"), "search query has not been set")
+		return
+	}
+
+	if search.Query != "" {
+		e.checkQuery(path, search.IsRegexp, search.IsBoolean, search.Query, requests)
+	}
+
+	if search.Scope != "" && !oneOf(search.Scope, searchScopes) {
+		e.add(joinPath(path, "scope"), "unknown search scope \"%s\" (must be one of %s)", search.Scope, strings.Join(searchScopes, ", "))
+	}
+
+	if search.EmailVerification != "" && !oneOf(search.EmailVerification, emailVerifications) {
+		e.add(
+			joinPath(path, "email_verification"),
+			"unknown email verification \"%s\" (must be one of %s)",
+			search.EmailVerification, strings.Join(emailVerifications, ", "),
+		)
+	}
+
+	var names map[string]bool = make(map[string]bool)
+	var outputFiles map[string]bool = make(map[string]bool)
+	for index, rule := range search.Rules {
+		rulePath := fmt.Sprintf("%s[%d]", joinPath(path, "rules"), index)
+
+		if strings.TrimSpace(rule.Name) == "" {
+			e.add(joinPath(rulePath, "name"), "must be set")
+		} else if names[rule.Name] {
+			e.add(joinPath(rulePath, "name"), "\"%s\" is used by another rule", rule.Name)
+		}
+		names[rule.Name] = true
+
+		e.checkQuery(rulePath, rule.IsRegexp, rule.IsBoolean, rule.Query, requests)
+
+		if rule.Scope != "" && !oneOf(rule.Scope, searchScopes) {
+			e.add(joinPath(rulePath, "scope"), "unknown search scope \"%s\" (must be one of %s)", rule.Scope, strings.Join(searchScopes, ", "))
+		}
+
+		if rule.OutputFile == "" {
+			continue
+		}
+
+		outputFile := filepath.Clean(rule.OutputFile)
+		if rule.Query != QueryEmail && rule.Query != QueryEverything && rule.Query != QueryMetadata &&
+			!IsEntityQuery(rule.Query) && IsSpecialQuery(rule.Query) {
+			e.add(joinPath(rulePath, "output_file"), "\"%s\" query does not output text results", rule.Query)
+		} else if !insideOutputDir(outputFile) {
+			e.add(joinPath(rulePath, "output_file"), "must be inside the output directory")
+		} else if outputFiles[outputFile] {
+			e.add(joinPath(rulePath, "output_file"), "\"%s\" is used by another rule", rule.OutputFile)
+		}
+		outputFiles[outputFile] = true
+	}
+
+	e.checkExtract(joinPath(path, "extract"), search.Extract, outputFiles)
+}
+
+// Whether cleaned relative path stays inside the output directory
+func insideOutputDir(outputFile string) bool {
+	return !filepath.IsAbs(outputFile) && outputFile != ".." && !strings.HasPrefix(outputFile, ".."+string(filepath.Separator))
+}
+
+// Check extraction settings at path. ruleOutputFiles are output files already used by search rules
+func (e *ValidationErrors) checkExtract(path string, extract Extract, ruleOutputFiles map[string]bool) {
+	if !extract.IsSet() {
+		if extract.Container != "" {
+			e.add(joinPath(path, "fields"), "no fields to extract from container \"%s\"", extract.Container)
+		}
+		return
+	}
+
+	if extract.Container != "" {
+		_, err := cascadia.Compile(extract.Container)
+		if err != nil {
+			e.add(joinPath(path, "container"), "invalid selector \"%s\": %s", extract.Container, err)
+		}
+	}
+
+	var names map[string]bool = make(map[string]bool)
+	for index, field := range extract.Fields {
+		fieldPath := fmt.Sprintf("%s[%d]", joinPath(path, "fields"), index)
+
+		if strings.TrimSpace(field.Name) == "" {
+			e.add(joinPath(fieldPath, "name"), "must be set")
+		} else if names[field.Name] {
+			e.add(joinPath(fieldPath, "name"), "\"%s\" is used by another field", field.Name)
+		}
+		names[field.Name] = true
+
+		if field.Selector != "" {
+			_, err := cascadia.Compile(field.Selector)
+			if err != nil {
+				e.add(joinPath(fieldPath, "selector"), "invalid selector \"%s\": %s", field.Selector, err)
+			}
+		} else if extract.Container == "" {
+			e.add(joinPath(fieldPath, "selector"), "must be set when there is no container")
+		}
+	}
+
+	if extract.OutputFile != "" {
+		outputFile := filepath.Clean(extract.OutputFile)
+		if !insideOutputDir(outputFile) {
+			e.add(joinPath(path, "output_file"), "must be inside the output directory")
+		} else if ruleOutputFiles[outputFile] {
+			e.add(joinPath(path, "output_file"), "\"%s\" is used by a search rule", extract.OutputFile)
+		}
+	}
+}
+
+// Check change detection settings at path
+func (e *ValidationErrors) checkMonitor(path string, monitor Monitor) {
+	for index, selector := range monitor.IgnoreSelectors {
+		_, err := cascadia.Compile(selector)
+		if err != nil {
+			e.add(fmt.Sprintf("%s[%d]", joinPath(path, "ignore_selectors"), index), "invalid selector \"%s\": %s", selector, err)
+		}
+	}
+
+	for index, expression := range monitor.IgnoreRegexps {
+		_, err := regexp.Compile(expression)
+		if err != nil {
+			e.add(fmt.Sprintf("%s[%d]", joinPath(path, "ignore_regexps"), index), "invalid regexp \"%s\": %s", expression, err)
+		}
+	}
+
+	var stateFile string = filepath.Clean(monitor.StateFile)
+	if monitor.StateFile != "" && !insideOutputDir(stateFile) {
+		e.add(joinPath(path, "state_file"), "must be inside the output directory")
+	}
+
+	var outputFile string = filepath.Clean(monitor.OutputFile)
+	if monitor.OutputFile != "" && !insideOutputDir(outputFile) {
+		e.add(joinPath(path, "output_file"), "must be inside the output directory")
+	} else if monitor.OutputFile != "" && monitor.StateFile != "" && outputFile == stateFile {
+		e.add(joinPath(path, "output_file"), "must differ from state_file")
+	}
+}
+
+// Check initial page URLs at path and seed sources at seedsPath
+func (e *ValidationErrors) checkInitialPages(path string, initialPages []string, seedsPath string, seeds Seeds) {
+	for index, initialPage := range initialPages {
+		if strings.TrimSpace(initialPage) == "" {
+			continue
+		}
+
+		_, err := ParseAbsoluteURL(initialPage)
+		if err != nil {
+			e.add(fmt.Sprintf("%s[%d]", path, index), "invalid URL \"%s\": %s", initialPage, err)
+		}
+	}
+
+	for _, source := range []struct {
+		name string
+		urls []string
+	}{{"sitemaps", seeds.Sitemaps}, {"feeds", seeds.Feeds}} {
+		for index, sourceURL := range source.urls {
+			if strings.TrimSpace(sourceURL) == "" {
+				continue
+			}
+
+			_, err := ParseAbsoluteURL(sourceURL)
+			if err != nil {
+				e.add(fmt.Sprintf("%s[%d]", joinPath(seedsPath, source.name), index), "invalid URL \"%s\": %s", sourceURL, err)
+			}
+		}
+	}
+
+	if isEmptyList(initialPages) && !seeds.hasSources() {
+		e.add(path, "no initial page URLs have been set neither here nor in %s", seedsPath)
+	}
+}
+
+// Check allowed and blacklisted domain URLs at given paths
+func (e *ValidationErrors) checkDomains(allowedPath string, allowedDomains []string, blacklistedPath string, blacklistedDomains []string) {
+	var allowedHosts map[string]bool = make(map[string]bool)
+	for index, allowedDomain := range allowedDomains {
+		if strings.TrimSpace(allowedDomain) == "" {
+			continue
+		}
+
+		parsedURL, err := ParseAbsoluteURL(allowedDomain)
+		if err != nil {
+			e.add(fmt.Sprintf("%s[%d]", allowedPath, index), "invalid URL \"%s\": %s", allowedDomain, err)
+			continue
+		}
+		allowedHosts[parsedURL.Host] = true
+	}
+
+	for index, blacklistedDomain := range blacklistedDomains {
+		if strings.TrimSpace(blacklistedDomain) == "" {
+			continue
+		}
+
+		parsedURL, err := ParseAbsoluteURL(blacklistedDomain)
+		if err != nil {
+			e.add(fmt.Sprintf("%s[%d]", blacklistedPath, index), "invalid URL \"%s\": %s", blacklistedDomain, err)
+			continue
+		}
+
+		if allowedHosts[parsedURL.Host] {
+			e.add(
+				fmt.Sprintf("%s[%d]", blacklistedPath, index),
+				"\"%s\" is both allowed and blacklisted", parsedURL.Host,
+			)
+		}
+	}
+}
+
+// Check scope rules at path
+func (e *ValidationErrors) checkScope(path string, rules []ScopeRule) {
+	for index, rule := range rules {
+		rulePath := fmt.Sprintf("%s[%d]", path, index)
+
+		if !oneOf(rule.Action, []string{ScopeAllow, ScopeDeny}) {
+			e.add(joinPath(rulePath, "action"), "unknown action \"%s\" (must be \"%s\" or \"%s\")", rule.Action, ScopeAllow, ScopeDeny)
+		}
+
+		if rule.Host == "" && rule.PathPrefix == "" && rule.Regexp == "" {
+			e.add(rulePath, "rule has no conditions; set host, path_prefix or regexp")
+		}
+
+		if strings.Contains(rule.Host, "/") {
+			e.add(joinPath(rulePath, "host"), "\"%s\" must not contain scheme or path", rule.Host)
+		}
+
+		if rule.IncludeSubdomains && rule.Host == "" {
+			e.add(joinPath(rulePath, "include_subdomains"), "host has not been set")
+		}
+
+		if rule.Regexp != "" {
+			_, err := regexp.Compile(rule.Regexp)
+			if err != nil {
+				e.add(joinPath(rulePath, "regexp"), "invalid regexp: %s", err)
+			}
+		}
+	}
+}
+
+// Check named crawl jobs
+func (e *ValidationErrors) checkJobs(c *Conf) {
+	if !isEmptyList(c.InitialPages) {
+		e.add("initial_pages", "not used when jobs are defined; set initial_pages of every job instead")
+	}
+
+	if c.Seeds.hasSources() {
+		e.add("seeds", "not used when jobs are defined; set seeds of every job instead")
+	}
+
+	var names map[string]bool = make(map[string]bool)
+	var outputDirs map[string]bool = make(map[string]bool)
+	for index, job := range c.CrawlJobs() {
+		path := fmt.Sprintf("jobs[%d]", index)
+
+		if strings.TrimSpace(job.Name) == "" {
+			e.add(joinPath(path, "name"), "must be set")
+		} else if names[job.Name] {
+			e.add(joinPath(path, "name"), "\"%s\" is used by another job", job.Name)
+		}
+		names[job.Name] = true
+
+		outputDir := filepath.Clean(job.OutputDir)
+		if filepath.IsAbs(outputDir) || outputDir == ".." || strings.HasPrefix(outputDir, ".."+string(filepath.Separator)) {
+			e.add(joinPath(path, "output_dir"), "must be a subdirectory of save.output_dir")
+		} else if outputDirs[outputDir] {
+			e.add(joinPath(path, "output_dir"), "\"%s\" is used by another job", job.OutputDir)
+		}
+		outputDirs[outputDir] = true
+
+		if c.Jobs[index].Search.IsSet() {
+			e.checkSearch(joinPath(path, "search"), job.Search, c.Requests)
+		} else if !job.Search.IsSet() && !c.Monitor.Enabled {
+			e.add(joinPath(path, "search.query"), "search query has not been set neither for the job nor at the top level")
+		}
+
+		e.checkInitialPages(joinPath(path, "initial_pages"), job.InitialPages, joinPath(path, "seeds"), job.Seeds)
+
+		if job.Depth == 0 {
+			e.add(joinPath(path, "depth"), "must be greater than 0")
+		}
+
+		e.checkDomains(
+			joinPath(path, "allowed_domains"), c.Jobs[index].AllowedDomains,
+			joinPath(path, "blacklisted_domains"), c.Jobs[index].BlacklistedDomains,
+		)
+		e.checkScope(joinPath(path, "scope"), c.Jobs[index].Scope)
+
+		if c.Jobs[index].CrawlMode != "" && !oneOf(c.Jobs[index].CrawlMode, crawlModes) {
+			e.add(joinPath(path, "crawl_mode"), "unknown crawl mode \"%s\" (must be one of %s)", c.Jobs[index].CrawlMode, strings.Join(crawlModes, ", "))
+		}
+	}
+}
+
+// Check configuration and report every problem found at once. Returns nil if
+// configuration is valid or ValidationErrors otherwise
+func (c *Conf) Validate() error {
+	var problems ValidationErrors
+
+	for _, unknownField := range c.unknownFields {
+		problems.add(unknownField, "unknown field")
+	}
+
+	if c.Version > CurrentVersion {
+		problems.add("version", "%d is newer than the supported %d, update the program", c.Version, CurrentVersion)
+	}
+
+	// search, crawl
+	if len(c.Jobs) == 0 {
+		// pages can be only watched for changes
+		if c.Search.IsSet() || !c.Monitor.Enabled {
+			problems.checkSearch("search", c.Search, c.Requests)
+		}
+		problems.checkInitialPages("initial_pages", c.InitialPages, "seeds", c.Seeds)
+	} else {
+		// top level search is only a default for jobs
+		if c.Search.IsSet() {
+			problems.checkSearch("search", c.Search, c.Requests)
+		}
+		problems.checkJobs(c)
+	}
+
+	// standard input can be read only once
+	var stdinUsers uint = 0
+	for _, job := range c.CrawlJobs() {
+		for _, seedFile := range job.Seeds.Files {
+			if strings.TrimSpace(seedFile) == SeedsStdin {
+				stdinUsers++
+			}
+		}
+	}
+	if stdinUsers > 1 {
+		problems.add("seeds.files", "standard input (\"%s\") is used as a seed file more than once", SeedsStdin)
+	}
+
+	if c.Depth == 0 {
+		problems.add("depth", "must be greater than 0")
+	}
+
+	if c.Workers == 0 {
+		problems.add("workers", "must be greater than 0")
+	}
+
+	problems.checkDomains("allowed_domains", c.AllowedDomains, "blacklisted_domains", c.BlacklistedDomains)
+	problems.checkScope("scope", c.Scope)
+	problems.checkMonitor("monitor", c.Monitor)
+
+	if c.Duplicates.MaxDistance > maxDuplicateDistance {
+		problems.add("duplicates.max_distance", "must be %d at most, otherwise unrelated pages are duplicates", maxDuplicateDistance)
+	}
+
+	if !oneOf(c.CrawlMode, crawlModes) {
+		problems.add("crawl_mode", "unknown crawl mode \"%s\" (must be one of %s)", c.CrawlMode, strings.Join(crawlModes, ", "))
+	}
+
+	// dashboard
+	if c.Dashboard.UseDashboard && c.Dashboard.Port == 0 {
+		problems.add("web_dashboard.port", "must be set when the dashboard is launched")
+	}
+
+	// save
+	if !c.Save.SavePages {
+		for _, job := range c.CrawlJobs() {
+			if job.Search.HasQuery(QueryArchive) {
+				problems.add("save.save_pages", "must be true for \"%s\" query, otherwise nothing is saved", QueryArchive)
+				break
+			}
+		}
+	}
+
+	// logging
+	if !oneOf(c.Logging.Level, logLevels) {
+		problems.add("logging.level", "unknown log level \"%s\"", c.Logging.Level)
+	}
+
+	if !oneOf(c.Logging.Format, logFormats) {
+		problems.add("logging.format", "unknown log format \"%s\"", c.Logging.Format)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return problems
+}
+
+// Find fields in decoded JSON document that do not exist in structure of type t.
+// Returns their JSON paths sorted alphabetically
+func findUnknownFields(document interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var unknownFields []string
+	switch value := document.(type) {
+	case map[string]interface{}:
+		if t.Kind() == reflect.Map {
+			for key, element := range value {
+				unknownFields = append(unknownFields, findUnknownFields(element, t.Elem(), joinPath(path, key))...)
+			}
+			break
+		}
+
+		if t.Kind() != reflect.Struct {
+			break
+		}
+
+		var fields map[string]reflect.Type = make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fields[strings.ToLower(name)] = field.Type
+		}
+
+		for key, element := range value {
+			// encoding/json matches keys case-insensitively
+			fieldType, ok := fields[strings.ToLower(key)]
+			if !ok {
+				unknownFields = append(unknownFields, joinPath(path, key))
+				continue
+			}
+			unknownFields = append(unknownFields, findUnknownFields(element, fieldType, joinPath(path, key))...)
+		}
+
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			break
+		}
+
+		for index, element := range value {
+			unknownFields = append(unknownFields, findUnknownFields(element, t.Elem(), fmt.Sprintf("%s[%d]", path, index))...)
+		}
+	}
+
+	sort.Strings(unknownFields)
+
+	return unknownFields
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
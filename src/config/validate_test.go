@@ -0,0 +1,166 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Get a valid configuration to break in tests
+func validConf() *Conf {
+	conf := Default()
+	conf.Search.Query = "wecr"
+	conf.InitialPages = []string{"https://example.org/"}
+
+	return conf
+}
+
+// Check that err reports problems at exactly the expected paths
+func checkProblemPaths(t *testing.T, err error, expected []string) {
+	t.Helper()
+
+	var paths []string
+	if err != nil {
+		problems, ok := err.(ValidationErrors)
+		if !ok {
+			t.Fatalf("expected ValidationErrors, got %T: %s", err, err)
+		}
+		for _, problem := range problems {
+			paths = append(paths, problem.Path)
+		}
+		sort.Strings(paths)
+	}
+
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected problems at %v, got %v", expected, paths)
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(conf *Conf)
+		paths  []string
+	}{
+		{"valid", func(conf *Conf) {}, nil},
+		{"no query", func(conf *Conf) { conf.Search.Query = "" }, []string{"search.query"}},
+		{"invalid regexp", func(conf *Conf) {
+			conf.Search.Query = "(unclosed"
+			conf.Search.IsRegexp = true
+		}, []string{"search.query"}},
+		{"regexp special query", func(conf *Conf) {
+			conf.Search.Query = QueryEmail
+			conf.Search.IsRegexp = true
+		}, []string{"search.is_regexp"}},
+		{"negated boolean query", func(conf *Conf) {
+			conf.Search.Query = "NOT python"
+			conf.Search.IsBoolean = true
+		}, []string{"search.query"}},
+		{"relative initial page", func(conf *Conf) {
+			conf.InitialPages = []string{"https://example.org/", "/relative"}
+		}, []string{"initial_pages[1]"}},
+		{"non-http initial page", func(conf *Conf) {
+			conf.InitialPages = []string{"mailto:bob@example.org"}
+		}, []string{"initial_pages[0]"}},
+		{"no initial pages", func(conf *Conf) { conf.InitialPages = []string{""} }, []string{"initial_pages"}},
+		{"zero depth and workers", func(conf *Conf) {
+			conf.Depth = 0
+			conf.Workers = 0
+		}, []string{"depth", "workers"}},
+		{"unknown log level", func(conf *Conf) { conf.Logging.Level = "loud" }, []string{"logging.level"}},
+		{"unknown crawl mode", func(conf *Conf) { conf.CrawlMode = "" }, []string{"crawl_mode"}},
+		{"valid rules", func(conf *Conf) {
+			conf.Search.Query = ""
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x"}, {Name: "b", Query: QueryEmail, OutputFile: "emails.json"}}
+		}, nil},
+		{"unnamed rule", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Query: "x"}}
+		}, []string{"search.rules[0].name"}},
+		{"rule without query", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a"}}
+		}, []string{"search.rules[0].query"}},
+		{"duplicate rule names", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x"}, {Name: "a", Query: "y"}}
+		}, []string{"search.rules[1].name"}},
+		{"unknown rule scope", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x", Scope: "body"}}
+		}, []string{"search.rules[0].scope"}},
+		{"regexp and boolean rule", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x", IsRegexp: true, IsBoolean: true}}
+		}, []string{"search.rules[0].is_boolean"}},
+		{"rule output outside output directory", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x", OutputFile: "../a.json"}}
+		}, []string{"search.rules[0].output_file"}},
+		{"file rule output", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: QueryImages, OutputFile: "images.json"}}
+		}, []string{"search.rules[0].output_file"}},
+		{"shared rule output file", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x", OutputFile: "out.json"}, {Name: "b", Query: "y", OutputFile: "./out.json"}}
+		}, []string{"search.rules[1].output_file"}},
+		{"rule output file shared with extraction", func(conf *Conf) {
+			conf.Search.Rules = []SearchRule{{Name: "a", Query: "x", OutputFile: "extracted.json"}}
+			conf.Search.Extract = Extract{Fields: []ExtractField{{Name: "title", Selector: "h1"}}, OutputFile: "extracted.json"}
+		}, []string{"search.extract.output_file"}},
+		{"too distant duplicates", func(conf *Conf) { conf.Duplicates.MaxDistance = 17 }, []string{"duplicates.max_distance"}},
+		{"newer version", func(conf *Conf) { conf.Version = CurrentVersion + 1 }, []string{"version"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := validConf()
+			test.change(conf)
+
+			checkProblemPaths(t, conf.Validate(), test.paths)
+		})
+	}
+}
+
+func TestValidateUnknownFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		extra  string
+		paths  []string
+	}{
+		{"none", `{"query": "wecr"}`, "", nil},
+		{"top level", `{"query": "wecr"}`, `, "wokers": 2`, []string{"wokers"}},
+		{"nested", `{"query": "wecr", "is_regex": true}`, "", []string{"search.is_regex"}},
+		{"in a list", `{"query": "wecr", "rules": [{"name": "a", "query": "b", "typo": 1}]}`, "", []string{"search.rules[0].typo"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := fmt.Sprintf(
+				`{"version": %d, "crawl_mode": "any", "search": %s, "initial_pages": ["https://example.org/"], "depth": 1, "workers": 1%s}`,
+				CurrentVersion, test.search, test.extra,
+			)
+
+			var conf Conf
+			err := conf.Decode(strings.NewReader(document), FormatJSON)
+			if err != nil {
+				t.Fatalf("failed to decode: %s", err)
+			}
+
+			checkProblemPaths(t, conf.Validate(), test.paths)
+		})
+	}
+}
@@ -0,0 +1,501 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/logger"
+	"unbewohnte/wecr/web"
+	"unbewohnte/wecr/worker"
+)
+
+const apiPrefix string = "/api/v1"
+
+// Pagination limits for list endpoints
+const (
+	apiDefaultLimit uint = 50
+	apiMaxLimit     uint = 500
+)
+
+// Error response. Every failed API request is answered with this
+type apiError struct {
+	Status   int                     `json:"status"`
+	Error    string                  `json:"error"`
+	Problems config.ValidationErrors `json:"problems,omitempty"`
+}
+
+type apiStatus struct {
+	Stats     worker.Statistics `json:"stats"`
+	Paused    bool              `json:"paused"`
+	Workers   uint              `json:"workers"`
+	QueueSize uint64            `json:"queue_size"`
+	// Statistics of every crawl job by its name, the only job has an empty name
+	Jobs map[string]worker.Statistics `json:"jobs"`
+}
+
+type apiQueuedJob struct {
+	Job   string `json:"job,omitempty"`
+	URL   string `json:"url"`
+	Query string `json:"query"`
+	// Names of search rules evaluated along with query
+	Rules []string `json:"rules,omitempty"`
+	Depth uint     `json:"depth"`
+}
+
+type apiHost struct {
+	Host string `json:"host"`
+	worker.HostStats
+	Queued uint64 `json:"queued"`
+}
+
+type apiQueue struct {
+	Size   uint64         `json:"size"`
+	Sample []apiQueuedJob `json:"sample"`
+	Hosts  []apiHost      `json:"hosts"`
+}
+
+type apiQueueDrop struct {
+	Host    string `json:"host"`
+	Dropped uint64 `json:"dropped"`
+}
+
+type apiResults struct {
+	Total   uint                  `json:"total"`
+	Offset  uint                  `json:"offset"`
+	Limit   uint                  `json:"limit"`
+	Results []worker.ResultRecord `json:"results"`
+}
+
+type apiErrors struct {
+	Errors []worker.ErrorRecord `json:"errors"`
+}
+
+type apiLogs struct {
+	Level string         `json:"level"`
+	Logs  []logger.Entry `json:"logs"`
+}
+
+// Configuration fields that are allowed to be changed at runtime
+type apiConfPatch struct {
+	Search *struct {
+		IsRegexp *bool   `json:"is_regexp"`
+		Query    *string `json:"query"`
+	} `json:"search"`
+	Requests *struct {
+		RequestWaitTimeoutMs  *uint64 `json:"request_wait_timeout_ms"`
+		RequestPauseMs        *uint64 `json:"request_pause_ms"`
+		ContentFetchTimeoutMs *uint64 `json:"content_fetch_timeout_ms"`
+		UserAgent             *string `json:"user_agent"`
+	} `json:"requests"`
+	Logging *struct {
+		OutputLogs *bool   `json:"output_logs"`
+		Level      *string `json:"level"`
+	} `json:"logging"`
+}
+
+// Write v as a JSON response with given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	jsonData, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		logger.Error("Failed to marshal API response: %s", err)
+		status = http.StatusInternalServerError
+		jsonData, _ = json.Marshal(apiError{
+			Status: status,
+			Error:  "failed to marshal response",
+		})
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
+
+// Write a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	writeJSON(w, status, apiError{
+		Status: status,
+		Error:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Wrap handler so it is only called with one of allowed methods
+func allowMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		for _, method := range methods {
+			if req.Method == method {
+				handler(w, req)
+				return
+			}
+		}
+
+		writeJSONError(w, http.StatusMethodNotAllowed, "method %s is not allowed", req.Method)
+	}
+}
+
+// Get an unsigned integer query parameter or fallback if there is none
+func queryUint(query url.Values, key string, fallback uint) (uint, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	number, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid \"%s\" parameter: %s", key, value)
+	}
+
+	return uint(number), nil
+}
+
+// Get "limit" query parameter, bounded by the maximum allowed limit
+func queryLimit(query url.Values) (uint, error) {
+	limit, err := queryUint(query, "limit", apiDefaultLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	if limit > apiMaxLimit {
+		limit = apiMaxLimit
+	}
+
+	return limit, nil
+}
+
+// Write current status of the worker pool
+func writeStatus(w http.ResponseWriter, pool *worker.Pool) {
+	queueSize, err := pool.VisitQueue.Size()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get queue size: %s", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiStatus{
+		Stats:     pool.Statistics(),
+		Paused:    pool.Stats.Stopped,
+		Workers:   pool.WorkersCount(),
+		QueueSize: queueSize,
+		Jobs:      pool.JobStats(),
+	})
+}
+
+// Write visit queue size, the next URLs to be visited and per-host statistics
+func writeQueue(w http.ResponseWriter, req *http.Request, pool *worker.Pool) {
+	sampleSize, err := queryUint(req.URL.Query(), "sample", 10)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	if sampleSize > apiMaxLimit {
+		sampleSize = apiMaxLimit
+	}
+
+	jobs, err := pool.VisitQueue.Jobs()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to read visit queue: %s", err)
+		return
+	}
+
+	var response apiQueue = apiQueue{
+		Size:   uint64(len(jobs)),
+		Sample: []apiQueuedJob{},
+		Hosts:  []apiHost{},
+	}
+
+	var hosts map[string]*apiHost = make(map[string]*apiHost)
+	for host, stats := range pool.Hosts.All() {
+		hosts[host] = &apiHost{
+			Host:      host,
+			HostStats: stats,
+		}
+	}
+
+	for index, job := range jobs {
+		if uint(index) < sampleSize {
+			var ruleNames []string
+			for _, rule := range job.Search.Rules {
+				ruleNames = append(ruleNames, rule.Name)
+			}
+
+			response.Sample = append(response.Sample, apiQueuedJob{
+				Job:   job.Name,
+				URL:   job.URL,
+				Query: job.Search.Query,
+				Rules: ruleNames,
+				Depth: job.Depth,
+			})
+		}
+
+		jobURL, err := url.Parse(job.URL)
+		if err != nil {
+			continue
+		}
+
+		host, ok := hosts[jobURL.Host]
+		if !ok {
+			host = &apiHost{
+				Host: jobURL.Host,
+			}
+			hosts[jobURL.Host] = host
+		}
+		host.Queued++
+	}
+
+	for _, host := range hosts {
+		response.Hosts = append(response.Hosts, *host)
+	}
+	sort.Slice(response.Hosts, func(i, j int) bool {
+		if response.Hosts[i].Queued == response.Hosts[j].Queued {
+			return response.Hosts[i].Host < response.Hosts[j].Host
+		}
+		return response.Hosts[i].Queued > response.Hosts[j].Queued
+	})
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Register versioned API handlers on mux
+func registerAPI(mux *http.ServeMux, conf *config.Conf, pool *worker.Pool) {
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, req *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "no such endpoint: %s", req.URL.Path)
+	})
+
+	mux.HandleFunc(apiPrefix+"/status", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		writeStatus(w, pool)
+	}, http.MethodGet))
+
+	mux.HandleFunc(apiPrefix+"/pause", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		if !pool.Stats.Stopped {
+			pool.Stop()
+			logger.Info("Stopped worker pool via API request")
+		}
+
+		writeStatus(w, pool)
+	}, http.MethodPost))
+
+	mux.HandleFunc(apiPrefix+"/resume", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		if pool.Stats.Stopped {
+			pool.Resume()
+			logger.Info("Resumed work via API request")
+		}
+
+		writeStatus(w, pool)
+	}, http.MethodPost))
+
+	mux.HandleFunc(apiPrefix+"/queue", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			writeQueue(w, req, pool)
+			return
+		}
+
+		// drop every queued URL of the host
+		host := req.URL.Query().Get("host")
+		if host == "" {
+			writeJSONError(w, http.StatusBadRequest, "\"host\" parameter is required")
+			return
+		}
+
+		dropped, err := pool.VisitQueue.Remove(func(job web.Job) bool {
+			jobURL, err := url.Parse(job.URL)
+			if err != nil {
+				return false
+			}
+			return strings.EqualFold(jobURL.Host, host)
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to drop queued URLs: %s", err)
+			return
+		}
+		logger.Info("Dropped %d queued URLs of %s via API request", dropped, host)
+
+		writeJSON(w, http.StatusOK, apiQueueDrop{
+			Host:    host,
+			Dropped: dropped,
+		})
+	}, http.MethodGet, http.MethodDelete))
+
+	mux.HandleFunc(apiPrefix+"/results", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		offset, err := queryUint(req.URL.Query(), "offset", 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		limit, err := queryLimit(req.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		filter := worker.ResultFilter{
+			Host: req.URL.Query().Get("host"),
+			Term: req.URL.Query().Get("q"),
+			Type: req.URL.Query().Get("type"),
+			Job:  req.URL.Query().Get("job"),
+			Rule: req.URL.Query().Get("rule"),
+		}
+
+		results, total := pool.History.Results(filter, offset, limit)
+		writeJSON(w, http.StatusOK, apiResults{
+			Total:   total,
+			Offset:  offset,
+			Limit:   limit,
+			Results: results,
+		})
+	}, http.MethodGet))
+
+	mux.HandleFunc(apiPrefix+"/errors", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		limit, err := queryLimit(req.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, apiErrors{
+			Errors: pool.History.Errors(limit),
+		})
+	}, http.MethodGet))
+
+	mux.HandleFunc(apiPrefix+"/logs", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		limit, err := queryLimit(req.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		level, err := logger.ParseLevel(req.URL.Query().Get("level"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, apiLogs{
+			Level: logger.GetLevel().String(),
+			Logs:  logger.Recent(level, req.URL.Query().Get("q"), int(limit)),
+		})
+	}, http.MethodGet))
+
+	mux.HandleFunc(apiPrefix+"/config", allowMethods(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, currentConf(conf, pool))
+			return
+		}
+
+		var patch apiConfPatch
+		defer req.Body.Close()
+		decoder := json.NewDecoder(req.Body)
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&patch)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid configuration patch: %s", err)
+			return
+		}
+
+		err = applyConfPatch(conf, pool, patch)
+		if problems, ok := err.(config.ValidationErrors); ok {
+			writeJSON(w, http.StatusUnprocessableEntity, apiError{
+				Status:   http.StatusUnprocessableEntity,
+				Error:    "invalid configuration",
+				Problems: problems,
+			})
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, "%s", err)
+			return
+		}
+		logger.Info("Changed configuration via API request")
+
+		writeJSON(w, http.StatusOK, currentConf(conf, pool))
+	}, http.MethodGet, http.MethodPatch))
+}
+
+// Get a copy of conf that workers of pool read while crawling
+func currentConf(conf *config.Conf, pool *worker.Pool) config.Conf {
+	var current config.Conf
+	pool.ViewConf(func() {
+		current = *conf
+	})
+
+	return current
+}
+
+// Check patch values and apply them to conf. Nothing is applied if any of the values is invalid
+func applyConfPatch(conf *config.Conf, pool *worker.Pool, patch apiConfPatch) error {
+	var patched config.Conf = currentConf(conf, pool)
+
+	if patch.Search != nil {
+		if patch.Search.IsRegexp != nil {
+			patched.Search.IsRegexp = *patch.Search.IsRegexp
+		}
+		if patch.Search.Query != nil {
+			patched.Search.Query = *patch.Search.Query
+		}
+	}
+
+	if patch.Requests != nil {
+		if patch.Requests.RequestWaitTimeoutMs != nil {
+			patched.Requests.RequestWaitTimeoutMs = *patch.Requests.RequestWaitTimeoutMs
+		}
+		if patch.Requests.RequestPauseMs != nil {
+			patched.Requests.RequestPauseMs = *patch.Requests.RequestPauseMs
+		}
+		if patch.Requests.ContentFetchTimeoutMs != nil {
+			patched.Requests.ContentFetchTimeoutMs = *patch.Requests.ContentFetchTimeoutMs
+		}
+		if patch.Requests.UserAgent != nil {
+			if *patch.Requests.UserAgent == "" {
+				return fmt.Errorf("requests.user_agent: can not be empty")
+			}
+			patched.Requests.UserAgent = *patch.Requests.UserAgent
+		}
+	}
+
+	if patch.Logging != nil {
+		if patch.Logging.OutputLogs != nil {
+			patched.Logging.OutputLogs = *patch.Logging.OutputLogs
+		}
+		if patch.Logging.Level != nil {
+			patched.Logging.Level = *patch.Logging.Level
+		}
+	}
+
+	err := patched.Validate()
+	if err != nil {
+		return err
+	}
+
+	// workers hold pointers to parts of conf, so change it in place while they wait
+	pool.Reconfigure(func() {
+		*conf = patched
+	})
+
+	logLevel, err := logger.ParseLevel(patched.Logging.Level)
+	if err == nil {
+		logger.SetLevel(logLevel)
+	}
+
+	return nil
+}
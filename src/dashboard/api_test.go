@@ -0,0 +1,185 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/queue"
+	"unbewohnte/wecr/web"
+	"unbewohnte/wecr/worker"
+)
+
+// Get API handlers of a pool without workers that has pages of two hosts queued
+func testAPI(t *testing.T) (*http.ServeMux, *config.Conf, *worker.Pool) {
+	conf := config.Default()
+	conf.Search.Query = "wecr"
+	conf.InitialPages = []string{"https://a.org/"}
+
+	visitQueue := queue.NewMemoryQueue(10)
+	for _, pageURL := range []string{"https://a.org/1", "https://b.org/", "https://a.org/2"} {
+		err := visitQueue.Push(web.Job{URL: pageURL, Search: conf.Search, Depth: 1})
+		if err != nil {
+			t.Fatalf("failed to queue %s: %s", pageURL, err)
+		}
+	}
+
+	pool := worker.NewWorkerPool(0, &worker.WorkerConf{
+		Requests:   &conf.Requests,
+		VisitQueue: visitQueue,
+		Jobs:       map[string]*worker.JobConf{"": {Search: &conf.Search, Stats: &worker.Statistics{}}},
+	}, &worker.Statistics{}, config.Budget{})
+
+	mux := http.NewServeMux()
+	registerAPI(mux, conf, pool)
+
+	return mux, conf, pool
+}
+
+// Make an API request, check its status and decode the response into response
+func apiRequest(t *testing.T, mux *http.ServeMux, method string, target string, body string, status int, response interface{}) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(method, apiPrefix+target, strings.NewReader(body)))
+
+	if recorder.Code != status {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", method, target, status, recorder.Code, recorder.Body)
+	}
+
+	err := json.Unmarshal(recorder.Body.Bytes(), response)
+	if err != nil {
+		t.Fatalf("%s %s: invalid response: %s", method, target, err)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	mux, _, _ := testAPI(t)
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/nothing", "", http.StatusNotFound},
+		{http.MethodPost, "/status", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/results?offset=-1", "", http.StatusBadRequest},
+		{http.MethodGet, "/logs?level=loud", "", http.StatusBadRequest},
+		{http.MethodDelete, "/queue", "", http.StatusBadRequest},
+		{http.MethodPatch, "/config", `{"depth": 1}`, http.StatusBadRequest},
+		{http.MethodPatch, "/config", `{"requests": {"user_agent": ""}}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		var response apiError
+		apiRequest(t, mux, test.method, test.target, test.body, test.status, &response)
+		if response.Status != test.status || response.Error == "" {
+			t.Errorf("%s %s: expected an error with status %d, got %+v", test.method, test.target, test.status, response)
+		}
+	}
+}
+
+func TestAPIStatus(t *testing.T) {
+	mux, _, _ := testAPI(t)
+
+	var status apiStatus
+	apiRequest(t, mux, http.MethodGet, "/status", "", http.StatusOK, &status)
+	if status.Paused || status.QueueSize != 3 || len(status.Jobs) != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	apiRequest(t, mux, http.MethodPost, "/pause", "", http.StatusOK, &status)
+	if !status.Paused {
+		t.Errorf("expected the pool to be paused")
+	}
+
+	apiRequest(t, mux, http.MethodPost, "/resume", "", http.StatusOK, &status)
+	if status.Paused {
+		t.Errorf("expected the pool to be resumed")
+	}
+}
+
+func TestAPIQueue(t *testing.T) {
+	mux, _, _ := testAPI(t)
+
+	var visitQueue apiQueue
+	apiRequest(t, mux, http.MethodGet, "/queue?sample=1", "", http.StatusOK, &visitQueue)
+	if visitQueue.Size != 3 || len(visitQueue.Sample) != 1 || visitQueue.Sample[0].URL != "https://a.org/1" {
+		t.Errorf("unexpected queue: %+v", visitQueue)
+	}
+	if len(visitQueue.Hosts) != 2 || visitQueue.Hosts[0].Host != "a.org" || visitQueue.Hosts[0].Queued != 2 {
+		t.Errorf("expected hosts with the most queued pages first, got %+v", visitQueue.Hosts)
+	}
+
+	var dropped apiQueueDrop
+	apiRequest(t, mux, http.MethodDelete, "/queue?host=A.org", "", http.StatusOK, &dropped)
+	if dropped.Dropped != 2 {
+		t.Errorf("expected 2 pages of a.org to be dropped, got %d", dropped.Dropped)
+	}
+
+	apiRequest(t, mux, http.MethodGet, "/queue", "", http.StatusOK, &visitQueue)
+	if visitQueue.Size != 1 || visitQueue.Sample[0].URL != "https://b.org/" {
+		t.Errorf("expected only b.org to be left, got %+v", visitQueue)
+	}
+}
+
+func TestAPIResults(t *testing.T) {
+	mux, _, pool := testAPI(t)
+	pool.History.AddResult(worker.ResultRecord{PageURL: "https://a.org/", Type: worker.ResultTypeText, Data: []string{"wecr"}})
+	pool.History.AddResult(worker.ResultRecord{PageURL: "https://a.org/", Type: worker.ResultTypeEmail, Data: []string{"bob@a.org"}})
+	pool.History.AddResult(worker.ResultRecord{PageURL: "https://b.org/", Type: worker.ResultTypeEmail, Data: []string{"bob@b.org"}})
+
+	var results apiResults
+	apiRequest(t, mux, http.MethodGet, "/results?type=email&limit=1", "", http.StatusOK, &results)
+	if results.Total != 2 || results.Limit != 1 || len(results.Results) != 1 || results.Results[0].Data[0] != "bob@b.org" {
+		t.Errorf("expected the newest of 2 emails, got %+v", results)
+	}
+
+	apiRequest(t, mux, http.MethodGet, "/results?host=a.org&offset=1", "", http.StatusOK, &results)
+	if results.Total != 2 || len(results.Results) != 1 || results.Results[0].Data[0] != "wecr" {
+		t.Errorf("expected the older result of a.org, got %+v", results)
+	}
+}
+
+func TestAPIConfig(t *testing.T) {
+	mux, conf, _ := testAPI(t)
+
+	var problems apiError
+	apiRequest(t, mux, http.MethodPatch, "/config", `{"search": {"query": "x"}, "logging": {"level": "loud"}}`, http.StatusUnprocessableEntity, &problems)
+	if len(problems.Problems) != 1 || problems.Problems[0].Path != "logging.level" {
+		t.Errorf("expected a problem with logging.level, got %+v", problems)
+	}
+	if conf.Search.Query != "wecr" {
+		t.Errorf("expected nothing to be applied from an invalid patch, query is %q", conf.Search.Query)
+	}
+
+	var patched config.Conf
+	apiRequest(t, mux, http.MethodPatch, "/config", `{"search": {"query": "crawler"}, "requests": {"request_pause_ms": 5}}`, http.StatusOK, &patched)
+	if patched.Search.Query != "crawler" || patched.Requests.RequestPauseMs != 5 {
+		t.Errorf("expected the patch in the response, got %+v", patched)
+	}
+	if conf.Search.Query != "crawler" || conf.Requests.RequestPauseMs != 5 {
+		t.Errorf("expected the patch to be applied")
+	}
+}
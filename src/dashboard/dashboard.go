@@ -47,6 +47,16 @@ type PoolStop struct {
 	Stop bool `json:"stop"`
 }
 
+// Serve third-party content in a sandbox of its own origin with scripts disabled,
+// so saved pages can't call the API on behalf of the dashboard
+func sandboxed(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		handler.ServeHTTP(w, req)
+	})
+}
+
 func NewDashboard(port uint16, webConf *config.Conf, pool *worker.Pool) *Dashboard {
 	mux := http.NewServeMux()
 	res, err := fs.Sub(resFS, "res")
@@ -57,15 +67,31 @@ func NewDashboard(port uint16, webConf *config.Conf, pool *worker.Pool) *Dashboa
 
 	mux.Handle("/static/", http.FileServer(http.FS(res)))
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-		template, err := template.ParseFS(res, "*.html")
-		if err != nil {
-			logger.Error("Failed to parse embedded dashboard FS: %s", err)
-			return
+	registerAPI(mux, webConf, pool)
+
+	// locally saved pages and fetched files
+	mux.Handle("/output/", sandboxed(
+		http.StripPrefix("/output/", http.FileServer(http.Dir(webConf.Save.OutputDir))),
+	))
+
+	// render one of the embedded pages
+	var page func(string) http.HandlerFunc = func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			template, err := template.ParseFS(res, "*.html")
+			if err != nil {
+				logger.Error("Failed to parse embedded dashboard FS: %s", err)
+				return
+			}
+
+			template.ExecuteTemplate(w, name, nil)
 		}
+	}
 
-		template.ExecuteTemplate(w, "index.html", nil)
-	})
+	mux.HandleFunc("/results", page("results.html"))
+	mux.HandleFunc("/queue", page("queue.html"))
+	mux.HandleFunc("/logs", page("logs.html"))
+
+	mux.HandleFunc("/", page("index.html"))
 
 	mux.HandleFunc("/stop", func(w http.ResponseWriter, req *http.Request) {
 		var stop PoolStop
@@ -91,13 +117,13 @@ func NewDashboard(port uint16, webConf *config.Conf, pool *worker.Pool) *Dashboa
 			logger.Info("Stopped worker pool via request from dashboard")
 		} else {
 			// resume work
-			pool.Work()
+			pool.Resume()
 			logger.Info("Resumed work via request from dashboard")
 		}
 	})
 
 	mux.HandleFunc("/stats", func(w http.ResponseWriter, req *http.Request) {
-		jsonStats, err := json.MarshalIndent(pool.Stats, "", " ")
+		jsonStats, err := json.MarshalIndent(pool.Statistics(), "", " ")
 		if err != nil {
 			http.Error(w, "Failed to marshal statistics", http.StatusInternalServerError)
 			logger.Error("Failed to marshal stats to send to the dashboard: %s", err)
@@ -127,15 +153,21 @@ func NewDashboard(port uint16, webConf *config.Conf, pool *worker.Pool) *Dashboa
 			}
 
 			// DO NOT blindly replace global configuration. Manually check and replace values
-			webConf.Search.IsRegexp = newConfig.Search.IsRegexp
-			if len(newConfig.Search.Query) != 0 {
-				webConf.Search.Query = newConfig.Search.Query
-			}
+			pool.Reconfigure(func() {
+				webConf.Search.IsRegexp = newConfig.Search.IsRegexp
+				if len(newConfig.Search.Query) != 0 {
+					webConf.Search.Query = newConfig.Search.Query
+				}
 
-			webConf.Logging.OutputLogs = newConfig.Logging.OutputLogs
+				webConf.Logging.OutputLogs = newConfig.Logging.OutputLogs
+			})
 
 		default:
-			jsonConf, err := json.MarshalIndent(webConf, "", " ")
+			var jsonConf []byte
+			var err error
+			pool.ViewConf(func() {
+				jsonConf, err = json.MarshalIndent(webConf, "", " ")
+			})
 			if err != nil {
 				http.Error(w, "Failed to marshal configuration", http.StatusInternalServerError)
 				logger.Error("Failed to marshal current configuration to send to the dashboard UI: %s", err)
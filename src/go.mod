@@ -1,3 +1,12 @@
 module unbewohnte/wecr
 
 go 1.18
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/net v0.12.0
+
+require github.com/andybalholm/cascadia v1.3.2
@@ -1,6 +1,6 @@
 /*
 	Wecr - crawl the web for data
-	Copyright (C) 2022 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+	Copyright (C) 2022, 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
 
 	This program is free software: you can redistribute it and/or modify
 	it under the terms of the GNU Affero General Public License as published by
@@ -19,13 +19,48 @@
 package logger
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// 3 basic loggers in global space
+// Importance of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+// How log lines are written
+type Format int
+
+const (
+	// Human-readable lines with fields appended as key=value pairs
+	FormatText Format = iota
+	// One JSON object per line
+	FormatJSON
+)
+
+// Set of named values attached to a log message, ie: url, host, worker id, duration
+type Fields map[string]interface{}
+
+// How many of the latest log lines are kept in memory
+const recentLimit int = 1000
+
+// basic loggers in global space
 var (
+	// verbose debug information logger
+	debugLog *log.Logger
 	// neutral information logger
 	infoLog *log.Logger
 	// warning-level information logger
@@ -34,17 +69,114 @@ var (
 	errorLog *log.Logger
 )
 
+// Messages less important than this are not logged at all. Accessed atomically
+var minLevel int32 = int32(LevelInfo)
+
+// Format of written log lines. Accessed atomically
+var lineFormat int32 = int32(FormatText)
+
+// Guards JSON lines so they are not interleaved
+var jsonLock sync.Mutex
+
+// Recently logged lines
+var recent struct {
+	entries []Entry
+	next    int
+	lock    sync.Mutex
+}
+
+// A single logged line
+type Entry struct {
+	TimeUnix int64  `json:"time_unix"`
+	Level    string `json:"level"`
+	Message  string `json:"message"`
+	Fields   Fields `json:"fields,omitempty"`
+	level    Level
+}
+
 func init() {
+	debugLog = log.New(os.Stdout, "[DEBUG] ", log.Ldate|log.Ltime)
 	infoLog = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime)
 	warningLog = log.New(os.Stdout, "[WARNING] ", log.Ldate|log.Ltime)
 	errorLog = log.New(os.Stdout, "[ERROR] ", log.Ldate|log.Ltime)
 }
 
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// Get level by its name. An empty name is treated as "info"
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warning", "warn":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level \"%s\"", name)
+	}
+}
+
+// Set the minimum level of messages to be logged
+func SetLevel(level Level) {
+	atomic.StoreInt32(&minLevel, int32(level))
+}
+
+// Get the minimum level of messages to be logged
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&minLevel))
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// Get format by its name. An empty name is treated as "text"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format \"%s\"", name)
+	}
+}
+
+// Set the format of written log lines
+func SetFormat(newFormat Format) {
+	atomic.StoreInt32(&lineFormat, int32(newFormat))
+}
+
+// Get the format of written log lines
+func GetFormat() Format {
+	return Format(atomic.LoadInt32(&lineFormat))
+}
+
 // Set up loggers to write to the given writer
 func SetOutput(writer io.Writer) {
 	if writer == nil {
 		writer = io.Discard
 	}
+	debugLog.SetOutput(writer)
 	infoLog.SetOutput(writer)
 	warningLog.SetOutput(writer)
 	errorLog.SetOutput(writer)
@@ -55,17 +187,170 @@ func GetOutput() io.Writer {
 	return infoLog.Writer()
 }
 
+// Remember a logged line, overwriting the oldest one if there are too many
+func remember(entry Entry) {
+	recent.lock.Lock()
+	defer recent.lock.Unlock()
+
+	if len(recent.entries) < recentLimit {
+		recent.entries = append(recent.entries, entry)
+		return
+	}
+
+	recent.entries[recent.next] = entry
+	recent.next = (recent.next + 1) % recentLimit
+}
+
+// Get no more than limit of recently logged lines, oldest first, that are at least as important
+// as level and contain text (case-insensitive) if it is not empty
+func Recent(level Level, text string, limit int) []Entry {
+	recent.lock.Lock()
+	defer recent.lock.Unlock()
+
+	text = strings.ToLower(text)
+
+	var entries []Entry = []Entry{}
+	for i := 0; i < len(recent.entries) && len(entries) < limit; i++ {
+		// walk from the newest to the oldest
+		index := (recent.next - 1 - i + 2*len(recent.entries)) % len(recent.entries)
+		entry := recent.entries[index]
+
+		if entry.level < level {
+			continue
+		}
+
+		if text != "" && !strings.Contains(strings.ToLower(entry.Message), text) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// oldest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries
+}
+
+// Write fields as sorted key=value pairs
+func formatFields(fields Fields) string {
+	var keys []string
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, key := range keys {
+		builder.WriteString(fmt.Sprintf(" %s=%v", key, fields[key]))
+	}
+
+	return builder.String()
+}
+
+// Log message with given level and fields via logger
+func logf(level Level, logger *log.Logger, fields Fields, format string, a ...interface{}) {
+	if level < GetLevel() {
+		return
+	}
+
+	now := time.Now()
+	entry := Entry{
+		TimeUnix: now.Unix(),
+		Level:    level.String(),
+		Message:  fmt.Sprintf(format, a...),
+		Fields:   fields,
+		level:    level,
+	}
+	remember(entry)
+
+	if currentFormat := GetFormat(); currentFormat == FormatJSON {
+		var line map[string]interface{} = make(map[string]interface{}, len(fields)+3)
+		for key, value := range fields {
+			line[key] = value
+		}
+		line["time"] = now.Format(time.RFC3339)
+		line["level"] = entry.Level
+		line["message"] = entry.Message
+
+		jsonLine, err := json.Marshal(line)
+		if err != nil {
+			return
+		}
+
+		jsonLock.Lock()
+		logger.Writer().Write(append(jsonLine, '\n'))
+		jsonLock.Unlock()
+		return
+	}
+
+	logger.Print(entry.Message + formatFields(fields))
+}
+
+// Logger that attaches the same fields to every message
+type FieldLogger struct {
+	fields Fields
+}
+
+// Get a logger that attaches fields to every message. Fields are copied, so changing them
+// afterwards does not affect the logger nor the lines it has logged
+func With(fields Fields) FieldLogger {
+	return FieldLogger{}.With(fields)
+}
+
+// Get a logger that attaches more fields along with the ones of this logger
+func (l FieldLogger) With(fields Fields) FieldLogger {
+	var merged Fields = make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	return FieldLogger{
+		fields: merged,
+	}
+}
+
+// Log debug information with fields
+func (l FieldLogger) Debug(format string, a ...interface{}) {
+	logf(LevelDebug, debugLog, l.fields, format, a...)
+}
+
+// Log information with fields
+func (l FieldLogger) Info(format string, a ...interface{}) {
+	logf(LevelInfo, infoLog, l.fields, format, a...)
+}
+
+// Log warning with fields
+func (l FieldLogger) Warning(format string, a ...interface{}) {
+	logf(LevelWarning, warningLog, l.fields, format, a...)
+}
+
+// Log error with fields
+func (l FieldLogger) Error(format string, a ...interface{}) {
+	logf(LevelError, errorLog, l.fields, format, a...)
+}
+
+// Log debug information
+func Debug(format string, a ...interface{}) {
+	logf(LevelDebug, debugLog, nil, format, a...)
+}
+
 // Log information
 func Info(format string, a ...interface{}) {
-	infoLog.Printf(format, a...)
+	logf(LevelInfo, infoLog, nil, format, a...)
 }
 
 // Log warning
 func Warning(format string, a ...interface{}) {
-	warningLog.Printf(format, a...)
+	logf(LevelWarning, warningLog, nil, format, a...)
 }
 
 // Log error
 func Error(format string, a ...interface{}) {
-	errorLog.Printf(format, a...)
+	logf(LevelError, errorLog, nil, format, a...)
 }
@@ -0,0 +1,178 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log file that is rotated when it grows too big or gets too old.
+// Rotated files are named "<path>.1" (the newest), "<path>.2" and so on
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	keep     uint
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	lock     sync.Mutex
+}
+
+// Open log file at path that is rotated when it exceeds maxSize bytes or is older than interval.
+// Zero maxSize or interval disable the corresponding rotation, in which case the file is truncated
+// on open like any other output file. No more than keep of rotated files are kept; zero keep keeps them all
+func OpenRotatingFile(path string, maxSize int64, interval time.Duration, keep uint) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		interval: interval,
+		keep:     keep,
+	}
+
+	var flags int = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if rotatingFile.rotates() {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	err := rotatingFile.open(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return rotatingFile, nil
+}
+
+// Whether the file rotates at all
+func (f *RotatingFile) rotates() bool {
+	return f.maxSize > 0 || f.interval > 0
+}
+
+func (f *RotatingFile) open(flags int) error {
+	file, err := os.OpenFile(f.path, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	stats, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = stats.Size()
+	f.openedAt = time.Now()
+
+	return nil
+}
+
+// Move current file aside, shifting older rotated files and removing the ones that exceed keep.
+// If the file can't be reopened, it is left closed and nil to be reopened by the next write
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+
+	// find the oldest rotated file
+	var last uint = 0
+	for {
+		_, err := os.Stat(fmt.Sprintf("%s.%d", f.path, last+1))
+		if err != nil {
+			break
+		}
+		last++
+	}
+
+	for index := last; index >= 1; index-- {
+		rotatedPath := fmt.Sprintf("%s.%d", f.path, index)
+		if f.keep != 0 && index >= f.keep {
+			os.Remove(rotatedPath)
+			continue
+		}
+		os.Rename(rotatedPath, fmt.Sprintf("%s.%d", f.path, index+1))
+	}
+
+	err = os.Rename(f.path, f.path+".1")
+	if err != nil {
+		// keep writing to the same file
+		reopenErr := f.open(os.O_CREATE | os.O_WRONLY | os.O_APPEND)
+		if reopenErr != nil {
+			return reopenErr
+		}
+		return err
+	}
+
+	return f.open(os.O_CREATE | os.O_WRONLY | os.O_TRUNC)
+}
+
+// Write data to the file, rotating it beforehand if needed
+func (f *RotatingFile) Write(data []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	// reopen the file if the last rotation has failed to
+	if f.file == nil {
+		err := f.open(os.O_CREATE | os.O_WRONLY | os.O_APPEND)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if f.size > 0 &&
+		((f.maxSize > 0 && f.size+int64(len(data)) > f.maxSize) ||
+			(f.interval > 0 && time.Since(f.openedAt) >= f.interval)) {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	written, err := f.file.Write(data)
+	f.size += int64(written)
+
+	return written, err
+}
+
+// Close the file
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed || f.file == nil {
+		f.closed = true
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	f.closed = true
+
+	return err
+}
@@ -28,12 +28,14 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 	"unbewohnte/wecr/config"
 	"unbewohnte/wecr/dashboard"
 	"unbewohnte/wecr/logger"
+	"unbewohnte/wecr/monitor"
 	"unbewohnte/wecr/queue"
+	"unbewohnte/wecr/scope"
 	"unbewohnte/wecr/utilities"
 	"unbewohnte/wecr/web"
 	"unbewohnte/wecr/worker"
@@ -47,8 +49,13 @@ const (
 	visitQueueFilename           string = "visit_queue.tmp"
 	textOutputFilename           string = "found_text.json"
 	emailsOutputFilename         string = "found_emails.json"
+	recordsOutputFilename        string = "found_records.json"
+	metadataOutputFilename       string = "found_metadata.json"
 )
 
+// How many jobs an in-memory visit queue holds per worker before queueing new links has to wait
+const memoryQueueJobsPerWorker int = 1000
+
 var (
 	printVersion = flag.Bool(
 		"version", false,
@@ -65,11 +72,34 @@ var (
 		"Configuration file name to create|look for",
 	)
 
+	checkConfig = flag.Bool(
+		"check-config", false,
+		"Validate configuration file, report every problem found and exit. Exits with non-zero code if configuration is invalid",
+	)
+
+	migrateConfig = flag.Bool(
+		"migrate-config", false,
+		"Upgrade configuration file to the current schema version, rewriting it in place (the original is kept with .bak extension), and exit",
+	)
+
+	scopeTest = flag.String(
+		"scope-test", "",
+		"Report whether the given URL is in scope of every crawl job and which rule decides it, then exit",
+	)
+
+	dumpConfig = flag.String(
+		"dump-config", "",
+		"Write effective configuration (file, environment variables and flags combined) to stdout in the given format (json, yaml, toml) and exit",
+	)
+
 	extractDataFilename = flag.String(
 		"extractData", "",
 		"Specify previously outputted JSON file and extract data from it, put each entry nicely on a new line in a new file, exit afterwards",
 	)
 
+	// configuration fields given via command-line
+	flagOverrides config.FlagOverrides
+
 	workingDirectory string
 	configFilePath   string
 )
@@ -82,8 +112,14 @@ func init() {
 	log.SetOutput(io.Discard)
 
 	// parse and process flags
+	flagOverrides.Register(flag.CommandLine)
 	flag.Parse()
 
+	// keep stdout clean for the dumped configuration
+	if *dumpConfig != "" {
+		logger.SetOutput(os.Stderr)
+	}
+
 	if *printVersion {
 		fmt.Printf(
 			"Wecr %s - crawl the web for data\n(c) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)\n",
@@ -133,189 +169,390 @@ func init() {
 	configFilePath = filepath.Join(workingDirectory, *configFile)
 }
 
-func main() {
-	// open config
-	logger.Info("Trying to open config \"%s\"", configFilePath)
+// Fill in values that are implied by configuration
+func prepareConf(conf *config.Conf) {
+	if conf.Requests.UserAgent == "" {
+		conf.Requests.UserAgent = "Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:47.0) Gecko/20100101 Firefox/47.0"
+		logger.Warning("User agent is not set. Forced to \"%s\"", conf.Requests.UserAgent)
+	}
 
-	var conf *config.Conf
-	conf, err := config.OpenConfigFile(configFilePath)
+	if !filepath.IsAbs(conf.Save.OutputDir) {
+		conf.Save.OutputDir = filepath.Join(workingDirectory, conf.Save.OutputDir)
+	}
+}
+
+// Set up log level, format and output according to logging configuration.
+// Returns opened log file, if any
+func setUpLogging(logging config.Logging) (*logger.RotatingFile, error) {
+	logLevel, err := logger.ParseLevel(logging.Level)
 	if err != nil {
-		logger.Error(
-			"Failed to open configuration file: %s. Creating a new one with the same name instead...",
-			err,
-		)
+		logger.Warning("%s. Logging everything from \"%s\" level", err, logLevel)
+	}
+	logger.SetLevel(logLevel)
 
-		err = config.CreateConfigFile(*config.Default(), configFilePath)
+	logFormat, err := logger.ParseFormat(logging.Format)
+	if err != nil {
+		logger.Warning("%s. Using \"%s\" log format", err, logFormat)
+	}
+	logger.SetFormat(logFormat)
+
+	if !logging.OutputLogs {
+		// no logging needed
+		logger.Info("No further logs will be outputted")
+		logger.SetOutput(nil)
+		return nil, nil
+	}
+
+	if logging.LogsFile == "" {
+		// output logs to stdout
+		logger.Info("Outputting logs to stdout")
+		logger.SetOutput(os.Stdout)
+		return nil, nil
+	}
+
+	// output logs to a file
+	logFile, err := logger.OpenRotatingFile(
+		filepath.Join(workingDirectory, logging.LogsFile),
+		int64(logging.RotateSizeMB)*1024*1024,
+		time.Duration(logging.RotateIntervalMinutes)*time.Minute,
+		logging.RotatedFilesKept,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Outputting logs to %s", logging.LogsFile)
+	logger.SetOutput(logFile)
+
+	return logFile, nil
+}
+
+// Create output directory and specialized ones for pages and files
+func createOutputDirectories(outputDir string) error {
+	for _, directory := range []string{
+		"",
+		config.SavePagesDir,
+		config.SaveImagesDir,
+		config.SaveVideosDir,
+		config.SaveAudioDir,
+		config.SaveDocumentsDir,
+	} {
+		err := os.MkdirAll(filepath.Join(outputDir, directory), os.ModePerm)
 		if err != nil {
-			logger.Error("Could not create new configuration file: %s", err)
-			return
+			return err
 		}
-		logger.Info("Created new configuration file. Exiting...")
+	}
 
-		return
+	return nil
+}
+
+// Tell what crawl job is looking for
+func logSearch(jobName string, search config.Search) {
+	var fields logger.Fields = logger.Fields{}
+	if jobName != "" {
+		fields["job"] = jobName
 	}
-	logger.Info("Successfully opened configuration file")
 
-	// sanitize and correct inputs
-	if len(conf.InitialPages) == 0 {
-		logger.Error("No initial page URLs have been set")
-		return
-	} else if len(conf.InitialPages) != 0 && conf.InitialPages[0] == "" {
-		logger.Error("No initial page URLs have been set")
-		return
+	for _, rule := range search.AllRules() {
+		if rule.Name != "" {
+			fields["rule"] = rule.Name
+		}
+		logQuery(logger.With(fields), rule)
 	}
+}
 
-	var sanitizedBlacklistedDomains []string
-	for _, blacklistedDomain := range conf.BlacklistedDomains {
-		if strings.TrimSpace(blacklistedDomain) == "" {
-			continue
+// Tell what a single search rule is looking for
+func logQuery(jobLog logger.FieldLogger, rule config.SearchRule) {
+	switch rule.Query {
+	case config.QueryEmail:
+		jobLog.Info("Looking for email addresses")
+	case config.QueryImages:
+		jobLog.Info("Looking for images (%+s)", web.ImageExtentions)
+	case config.QueryVideos:
+		jobLog.Info("Looking for videos (%+s)", web.VideoExtentions)
+	case config.QueryAudio:
+		jobLog.Info("Looking for audio (%+s)", web.AudioExtentions)
+	case config.QueryDocuments:
+		jobLog.Info("Looking for documents (%+s)", web.DocumentExtentions)
+	case config.QueryArchive:
+		jobLog.Info("Archiving every visited page")
+	case config.QueryPhone:
+		jobLog.Info("Looking for international phone numbers")
+	case config.QueryIP:
+		jobLog.Info("Looking for IPv4 and IPv6 addresses")
+	case config.QueryURL:
+		jobLog.Info("Looking for URLs in text")
+	case config.QueryIBAN:
+		jobLog.Info("Looking for IBANs")
+	case config.QueryCreditCard:
+		jobLog.Info("Looking for payment card numbers")
+	case config.QueryCryptoWallet:
+		jobLog.Info("Looking for cryptocurrency wallet addresses")
+	case config.QuerySocialHandle:
+		jobLog.Info("Looking for social media handles")
+	case config.QueryMetadata:
+		jobLog.Info("Extracting page metadata (JSON-LD, OpenGraph, Twitter cards, microdata)")
+	case config.QueryEverything:
+		jobLog.Info("Looking for email addresses, images, videos, audio and various documents (%+s - %+s - %+s - %+s)",
+			web.ImageExtentions,
+			web.VideoExtentions,
+			web.AudioExtentions,
+			web.DocumentExtentions,
+		)
+	default:
+		if rule.IsRegexp {
+			jobLog.Info("Looking for RegExp matches (%s)", rule.Query)
+		} else if rule.IsBoolean {
+			jobLog.Info("Looking for pages matching boolean query (%s)", rule.Query)
+		} else {
+			jobLog.Info("Looking for text matches (%s)", rule.Query)
 		}
+	}
+}
 
-		parsedURL, err := url.Parse(blacklistedDomain)
-		if err != nil {
-			logger.Warning("Failed to parse blacklisted \"%s\": %s", blacklistedDomain, err)
+// Create directories of output file at path and open it for writing. Existing file
+// is truncated unless appendToExisting is true
+func openOutputFile(outputPath string, appendToExisting bool) (*os.File, error) {
+	err := os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags int = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendToExisting {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	return os.OpenFile(outputPath, flags, 0644)
+}
+
+// Open output files of search rules that have them and of extracted records if they are not
+// opened yet. Existing files are truncated unless appendToExisting is true
+func openSearchOutputs(jobConf *worker.JobConf, search config.Search, appendToExisting bool) error {
+	var outputs map[string]io.Writer = make(map[string]io.Writer)
+	for name, output := range jobConf.RuleOutputs {
+		outputs[name] = output
+	}
+
+	for _, rule := range search.Rules {
+		if rule.OutputFile == "" {
+			delete(outputs, rule.Name)
 			continue
 		}
-
-		if parsedURL.Scheme == "" {
-			// parsing is invalid, as stdlib says
-			logger.Warning("Failed to parse blacklisted \"%s\": no scheme specified", blacklistedDomain)
+		if _, ok := outputs[rule.Name]; ok {
 			continue
 		}
 
-		sanitizedBlacklistedDomains = append(sanitizedBlacklistedDomains, parsedURL.Host)
+		outputFile, err := openOutputFile(filepath.Join(jobConf.Save.OutputDir, rule.OutputFile), appendToExisting)
+		if err != nil {
+			return err
+		}
+		outputs[rule.Name] = outputFile
+	}
+
+	// workers read outputs while crawling, so replace them at once
+	jobConf.RuleOutputs = outputs
+
+	if !search.Extract.IsSet() {
+		return nil
 	}
-	conf.BlacklistedDomains = sanitizedBlacklistedDomains
 
-	var sanitizedAllowedDomains []string
-	for _, allowedDomain := range conf.AllowedDomains {
-		if strings.TrimSpace(allowedDomain) == "" {
+	var recordsOutput string = recordsOutputFilename
+	if search.Extract.OutputFile != "" {
+		recordsOutput = filepath.Clean(search.Extract.OutputFile)
+	}
+	if jobConf.RecordsOutput != nil && jobConf.RecordsOutputFile == recordsOutput {
+		return nil
+	}
+
+	outputFile, err := openOutputFile(filepath.Join(jobConf.Save.OutputDir, recordsOutput), appendToExisting)
+	if err != nil {
+		return err
+	}
+	jobConf.RecordsOutput = outputFile
+	jobConf.RecordsOutputFile = recordsOutput
+
+	return nil
+}
+
+// Save pages of this crawl for the next one and, if the crawl is complete, output pages that
+// have been removed since the previous one
+func finishMonitors(jobConfs map[string]*worker.JobConf, stats *worker.Statistics, complete bool) {
+	for name, jobConf := range jobConfs {
+		if jobConf.Monitor == nil {
 			continue
 		}
 
-		parsedURL, err := url.Parse(allowedDomain)
-		if err != nil {
-			logger.Warning("Failed to parse allowed \"%s\": %s", allowedDomain, err)
-			continue
+		var fields logger.Fields = logger.Fields{}
+		if name != "" {
+			fields["job"] = name
 		}
+		jobLog := logger.With(fields)
 
-		if parsedURL.Scheme == "" {
-			// parsing is invalid, as stdlib says
-			logger.Warning("Failed to parse allowed \"%s\": no scheme specified", allowedDomain)
+		removed, err := jobConf.Monitor.Finish(complete)
+		if err != nil {
+			jobLog.Error("Failed to save pages for change detection: %s", err)
 			continue
 		}
 
-		sanitizedAllowedDomains = append(sanitizedAllowedDomains, parsedURL.Host)
+		for _, change := range removed {
+			jobLog.Info("Page %s has been removed", change.URL)
+		}
+		atomic.AddUint64(&stats.ChangesDetected, uint64(len(removed)))
+		atomic.AddUint64(&jobConf.Stats.ChangesDetected, uint64(len(removed)))
+		if !complete {
+			jobLog.Warning("The crawl is incomplete; pages that have not been visited are not reported as removed")
+		}
 	}
-	conf.AllowedDomains = sanitizedAllowedDomains
+}
 
-	if conf.Depth <= 0 {
-		conf.Depth = 1
-		logger.Warning("Depth is <= 0. Set to %d", conf.Depth)
-	}
+func main() {
+	if *migrateConfig {
+		logger.Info("Migrating configuration file \"%s\"", configFilePath)
+		changes, backupPath, err := config.MigrateConfigFile(configFilePath)
+		if err != nil {
+			logger.Error("Failed to migrate configuration file: %s", err)
+			os.Exit(1)
+		}
 
-	if conf.Workers <= 0 {
-		conf.Workers = 5
-		logger.Warning("Workers number is <= 0. Set to %d", conf.Workers)
-	}
+		if len(changes) == 0 {
+			logger.Info("Configuration file is already up to date (version %d)", config.CurrentVersion)
+			os.Exit(0)
+		}
 
-	if conf.Search.Query == "" {
-		logger.Warning("Search query has not been set")
-		return
+		for _, change := range changes {
+			logger.Info("%s", change)
+		}
+		logger.Info("Migrated configuration file to version %d. The original is kept as \"%s\"", config.CurrentVersion, backupPath)
+		os.Exit(0)
 	}
 
-	if conf.Requests.UserAgent == "" {
-		conf.Requests.UserAgent = "Mozilla/5.0 (Windows NT 6.1; Win64; x64; rv:47.0) Gecko/20100101 Firefox/47.0"
-		logger.Warning("User agent is not set. Forced to \"%s\"", conf.Requests.UserAgent)
-	}
+	// open config
+	logger.Info("Trying to open config \"%s\"", configFilePath)
 
-	// create output directory and corresponding specialized ones, text output files
-	if !filepath.IsAbs(conf.Save.OutputDir) {
-		conf.Save.OutputDir = filepath.Join(workingDirectory, conf.Save.OutputDir)
-	}
-	err = os.MkdirAll(conf.Save.OutputDir, os.ModePerm)
-	if err != nil {
-		logger.Error("Failed to create output directory: %s", err)
-		return
-	}
+	var conf *config.Conf
+	conf, err := config.OpenConfigFile(configFilePath)
+	useDefaults := !flagOverrides.Empty() || config.HasEnvOverrides(os.Environ()) || *dumpConfig != ""
+	if err != nil && os.IsNotExist(err) && useDefaults {
+		// everything is set via environment and|or flags
+		logger.Info("No configuration file found. Using default configuration")
+		err = nil
+	} else if err != nil && *checkConfig {
+		logger.Error("Failed to open configuration file: %s", err)
+		os.Exit(1)
+	} else if err != nil {
+		logger.Error(
+			"Failed to open configuration file: %s. Creating a new one with the same name instead...",
+			err,
+		)
+
+		err = config.CreateConfigFile(*config.Default(), configFilePath)
+		if err != nil {
+			logger.Error("Could not create new configuration file: %s", err)
+			return
+		}
+		logger.Info("Created new configuration file. Exiting...")
 
-	err = os.MkdirAll(filepath.Join(conf.Save.OutputDir, config.SavePagesDir), os.ModePerm)
-	if err != nil {
-		logger.Error("Failed to create output directory for pages: %s", err)
 		return
+	} else {
+		logger.Info("Successfully opened configuration file")
 	}
 
-	err = os.MkdirAll(filepath.Join(conf.Save.OutputDir, config.SaveImagesDir), os.ModePerm)
-	if err != nil {
-		logger.Error("Failed to create output directory for images: %s", err)
-		return
+	if len(conf.Migrations()) != 0 {
+		logger.Warning("Configuration file is of an older version, it has been upgraded in memory:")
+		for _, change := range conf.Migrations() {
+			logger.Warning("%s", change)
+		}
+		logger.Warning("Run with -migrate-config to upgrade the file itself")
 	}
 
-	err = os.MkdirAll(filepath.Join(conf.Save.OutputDir, config.SaveVideosDir), os.ModePerm)
+	// apply overrides: environment variables first, command-line flags last
+	err = conf.ApplyEnv(os.Environ())
 	if err != nil {
-		logger.Error("Failed to create output directory for video: %s", err)
+		logger.Error("Invalid environment variables:")
+		for _, problem := range err.(config.ValidationErrors) {
+			logger.Error("%s", problem)
+		}
+
+		if *checkConfig {
+			os.Exit(1)
+		}
 		return
 	}
 
-	err = os.MkdirAll(filepath.Join(conf.Save.OutputDir, config.SaveAudioDir), os.ModePerm)
+	err = flagOverrides.Apply(conf)
 	if err != nil {
-		logger.Error("Failed to create output directory for audio: %s", err)
+		logger.Error("Invalid command-line flag: %s", err)
+		if *checkConfig {
+			os.Exit(1)
+		}
 		return
 	}
 
-	err = os.MkdirAll(filepath.Join(conf.Save.OutputDir, config.SaveDocumentsDir), os.ModePerm)
-	if err != nil {
-		logger.Error("Failed to create output directory for documents: %s", err)
-		return
+	if *dumpConfig != "" {
+		format, err := config.ParseFormat(*dumpConfig)
+		if err != nil {
+			logger.Error("Failed to dump configuration: %s", err)
+			os.Exit(1)
+		}
+
+		err = conf.Encode(os.Stdout, format)
+		if err != nil {
+			logger.Error("Failed to dump configuration: %s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
-	textOutputFile, err := os.Create(filepath.Join(conf.Save.OutputDir, textOutputFilename))
+	// make sure configuration makes sense
+	err = conf.Validate()
 	if err != nil {
-		logger.Error("Failed to create text output file: %s", err)
+		logger.Error("Configuration is invalid:")
+		for _, problem := range err.(config.ValidationErrors) {
+			logger.Error("%s", problem)
+		}
+
+		if *checkConfig {
+			os.Exit(1)
+		}
 		return
 	}
-	defer textOutputFile.Close()
 
-	emailsOutputFile, err := os.Create(filepath.Join(conf.Save.OutputDir, emailsOutputFilename))
-	if err != nil {
-		logger.Error("Failed to create email addresses output file: %s", err)
-		return
+	if *checkConfig {
+		logger.Info("Configuration is valid")
+		os.Exit(0)
 	}
-	defer emailsOutputFile.Close()
 
-	switch conf.Search.Query {
-	case config.QueryEmail:
-		logger.Info("Looking for email addresses")
-	case config.QueryImages:
-		logger.Info("Looking for images (%+s)", web.ImageExtentions)
-	case config.QueryVideos:
-		logger.Info("Looking for videos (%+s)", web.VideoExtentions)
-	case config.QueryAudio:
-		logger.Info("Looking for audio (%+s)", web.AudioExtentions)
-	case config.QueryDocuments:
-		logger.Info("Looking for documents (%+s)", web.DocumentExtentions)
-	case config.QueryArchive:
-		logger.Info("Archiving every visited page")
-	case config.QueryEverything:
-		logger.Info("Looking for email addresses, images, videos, audio and various documents (%+s - %+s - %+s - %+s)",
-			web.ImageExtentions,
-			web.VideoExtentions,
-			web.AudioExtentions,
-			web.DocumentExtentions,
-		)
-	default:
-		if conf.Search.IsRegexp {
-			logger.Info("Looking for RegExp matches (%s)", conf.Search.Query)
-		} else {
-			logger.Info("Looking for text matches (%s)", conf.Search.Query)
+	if *scopeTest != "" {
+		testURL, err := url.Parse(*scopeTest)
+		if err != nil {
+			logger.Error("Invalid URL \"%s\": %s", *scopeTest, err)
+			os.Exit(1)
+		}
+
+		for _, crawlJob := range conf.CrawlJobs() {
+			rules, err := scope.New(crawlJob.Scope, crawlJob.AllowedDomains, crawlJob.BlacklistedDomains)
+			if err != nil {
+				logger.Error("Invalid scope rules: %s", err)
+				os.Exit(1)
+			}
+
+			if crawlJob.Name != "" {
+				logger.Info("[%s] %s is %s", crawlJob.Name, testURL, rules.Explain(testURL))
+			} else {
+				logger.Info("%s is %s", testURL, rules.Explain(testURL))
+			}
 		}
+		os.Exit(0)
 	}
 
+	prepareConf(conf)
+
 	// create visit queue file if not turned off
-	var visitQueueFile *os.File = nil
+	var visitQueue *queue.VisitQueue
+	var initialJobs []web.Job
 	if !conf.InMemoryVisitQueue {
-		var err error
-		visitQueueFile, err = os.Create(filepath.Join(workingDirectory, visitQueueFilename))
+		visitQueueFile, err := os.Create(filepath.Join(workingDirectory, visitQueueFilename))
 		if err != nil {
 			logger.Error("Could not create visit queue temporary file: %s", err)
 			return
@@ -324,116 +561,266 @@ func main() {
 			visitQueueFile.Close()
 			os.Remove(filepath.Join(workingDirectory, visitQueueFilename))
 		}()
+		visitQueue = queue.NewFileQueue(visitQueueFile)
 	}
 
-	// create initial jobs
-	initialJobs := make(chan web.Job, conf.Workers*5)
-	if !conf.InMemoryVisitQueue {
-		for _, initialPage := range conf.InitialPages {
-			var newJob web.Job = web.Job{
-				URL:    initialPage,
-				Search: conf.Search,
-				Depth:  conf.Depth,
+	// Prepare global statistics variable
+	statistics := worker.Statistics{}
+
+	// set up every crawl job: output directories and files, initial visits
+	crawlJobs := conf.CrawlJobs()
+	var jobConfs map[string]*worker.JobConf = make(map[string]*worker.JobConf)
+	for index, crawlJob := range crawlJobs {
+		jobConf := &worker.JobConf{
+			Name:         crawlJob.Name,
+			Search:       &crawlJobs[index].Search,
+			Save:         &conf.Save,
+			OutputSubdir: filepath.ToSlash(crawlJob.OutputDir),
+			CrawlMode:    crawlJob.CrawlMode,
+			OffsiteHops:  crawlJob.OffsiteHops,
+			Stats:        &worker.Statistics{},
+		}
+
+		jobConf.Scope, err = scope.New(crawlJob.Scope, crawlJob.AllowedDomains, crawlJob.BlacklistedDomains)
+		if err != nil {
+			logger.Error("Invalid scope rules: %s", err)
+			return
+		}
+
+		if len(conf.Jobs) == 0 {
+			// the only job; its search can be changed at runtime via dashboard
+			jobConf.Search = &conf.Search
+		} else {
+			jobConf.Save = &config.Save{
+				OutputDir: filepath.Join(conf.Save.OutputDir, crawlJob.OutputDir),
+				SavePages: conf.Save.SavePages,
 			}
-			err = queue.InsertNewJob(visitQueueFile, newJob)
+		}
+
+		// create output directory and corresponding specialized ones, text output files
+		err = createOutputDirectories(jobConf.Save.OutputDir)
+		if err != nil {
+			logger.Error("Failed to create output directories: %s", err)
+			return
+		}
+
+		textOutputFile, err := os.Create(filepath.Join(jobConf.Save.OutputDir, textOutputFilename))
+		if err != nil {
+			logger.Error("Failed to create text output file: %s", err)
+			return
+		}
+		defer textOutputFile.Close()
+		jobConf.TextOutput = textOutputFile
+
+		emailsOutputFile, err := os.Create(filepath.Join(jobConf.Save.OutputDir, emailsOutputFilename))
+		if err != nil {
+			logger.Error("Failed to create email addresses output file: %s", err)
+			return
+		}
+		defer emailsOutputFile.Close()
+		jobConf.EmailsOutput = emailsOutputFile
+
+		metadataOutputFile, err := os.Create(filepath.Join(jobConf.Save.OutputDir, metadataOutputFilename))
+		if err != nil {
+			logger.Error("Failed to create metadata output file: %s", err)
+			return
+		}
+		defer metadataOutputFile.Close()
+		jobConf.MetadataOutput = metadataOutputFile
+
+		err = openSearchOutputs(jobConf, crawlJob.Search, false)
+		if err != nil {
+			logger.Error("Failed to create search output file: %s", err)
+			return
+		}
+
+		if conf.Monitor.Enabled {
+			var changesOutput string = monitor.DefaultOutputFile
+			if conf.Monitor.OutputFile != "" {
+				changesOutput = conf.Monitor.OutputFile
+			}
+			var stateFile string = monitor.DefaultStateFile
+			if conf.Monitor.StateFile != "" {
+				stateFile = conf.Monitor.StateFile
+			}
+
+			changesOutputFile, err := openOutputFile(filepath.Join(jobConf.Save.OutputDir, changesOutput), false)
 			if err != nil {
-				logger.Error("Failed to encode an initial job to the visit queue: %s", err)
-				continue
+				logger.Error("Failed to create changes output file: %s", err)
+				return
+			}
+			defer changesOutputFile.Close()
+
+			jobConf.Monitor, err = monitor.New(
+				crawlJob.Name, conf.Monitor, filepath.Join(jobConf.Save.OutputDir, stateFile), changesOutputFile,
+			)
+			if err != nil {
+				logger.Error("Failed to read pages of the previous crawl: %s", err)
+				return
 			}
 		}
-		visitQueueFile.Seek(0, io.SeekStart)
-	} else {
-		for _, initialPage := range conf.InitialPages {
-			initialJobs <- web.Job{
-				URL:    initialPage,
-				Search: conf.Search,
-				Depth:  conf.Depth,
+
+		if conf.Duplicates.Skip {
+			jobConf.Duplicates = worker.NewDuplicates(conf.Duplicates.MaxDistance)
+		}
+
+		jobConfs[crawlJob.Name] = jobConf
+		logSearch(crawlJob.Name, crawlJob.Search)
+		if jobConf.Monitor != nil {
+			var fields logger.Fields = logger.Fields{}
+			if crawlJob.Name != "" {
+				fields["job"] = crawlJob.Name
 			}
+			logger.With(fields).Info(
+				"Watching pages for changes since the previous crawl of %d pages", jobConf.Monitor.PreviousPages(),
+			)
+		}
+
+		// create initial jobs
+		seeds := collectSeeds(crawlJob, conf.Requests)
+		if len(seeds) == 0 && crawlJob.Name != "" {
+			logger.Warning("No initial pages to visit have been found for job \"%s\"", crawlJob.Name)
+		} else if len(seeds) == 0 {
+			logger.Warning("No initial pages to visit have been found")
+		}
+		for _, initialPage := range seeds {
+			if initialPageURL, err := url.Parse(initialPage); err == nil {
+				if allowed, _ := jobConf.Scope.Match(initialPageURL); !allowed {
+					logger.Warning(
+						"Initial page %s is out of scope and will not be visited: %s",
+						initialPage, jobConf.Scope.Explain(initialPageURL),
+					)
+				}
+			}
+
+			initialJobs = append(initialJobs, web.Job{
+				URL:    initialPage,
+				Search: crawlJob.Search,
+				Depth:  crawlJob.Depth,
+				Name:   crawlJob.Name,
+				Seed:   initialPage,
+			})
 		}
 	}
 
-	// Prepare global statistics variable
-	statistics := worker.Statistics{}
+	// memory queue fits every initial job no matter how many of them there are
+	if conf.InMemoryVisitQueue {
+		var capacity int = int(conf.Workers) * memoryQueueJobsPerWorker
+		if len(initialJobs) > capacity {
+			capacity = len(initialJobs)
+		}
+		visitQueue = queue.NewMemoryQueue(capacity)
+	}
+	for _, initialJob := range initialJobs {
+		err = visitQueue.Push(initialJob)
+		if err != nil {
+			logger.Error("Failed to encode an initial job to the visit queue: %s", err)
+			continue
+		}
+	}
 
 	// form a worker pool
-	workerPool := worker.NewWorkerPool(initialJobs, conf.Workers, &worker.WorkerConf{
-		Search:             &conf.Search,
-		Requests:           &conf.Requests,
-		Save:               &conf.Save,
-		BlacklistedDomains: conf.BlacklistedDomains,
-		AllowedDomains:     conf.AllowedDomains,
-		VisitQueue: worker.VisitQueue{
-			VisitQueue: visitQueueFile,
-			Lock:       &sync.Mutex{},
-		},
-		EmailsOutput: emailsOutputFile,
-		TextOutput:   textOutputFile,
-	}, &statistics)
+	workerConf := &worker.WorkerConf{
+		Requests:      &conf.Requests,
+		VisitQueue:    visitQueue,
+		Jobs:          jobConfs,
+		EmailVerifier: web.NewEmailVerifier(nil),
+	}
+	workerPool := worker.NewWorkerPool(conf.Workers, workerConf, &statistics, conf.Budget)
 	logger.Info("Created a worker pool with %d workers", conf.Workers)
 
+	// conf can be changed via dashboard and reloads while crawling, the rest is done with the settings it started with
+	var startConf config.Conf = *conf
+
+	reloader := &configReloader{
+		conf:       conf,
+		workerConf: workerConf,
+	}
+
 	// open dashboard if needed
 	var board *dashboard.Dashboard = nil
 	if conf.Dashboard.UseDashboard {
 		board = dashboard.NewDashboard(conf.Dashboard.Port, conf, workerPool)
 		go board.Launch()
-		logger.Info("Launched dashboard at http://localhost:%d", conf.Dashboard.Port)
+		logger.Info("Launched dashboard at http://localhost:%d", startConf.Dashboard.Port)
 	}
 
 	// create and redirect logs if needed
-	if conf.Logging.OutputLogs {
-		if conf.Logging.LogsFile != "" {
-			// output logs to a file
-			logFile, err := os.Create(filepath.Join(workingDirectory, conf.Logging.LogsFile))
-			if err != nil {
-				logger.Error("Failed to create logs file: %s", err)
-				return
-			}
-			defer logFile.Close()
-
-			logger.Info("Outputting logs to %s", conf.Logging.LogsFile)
-			logger.SetOutput(logFile)
-		} else {
-			// output logs to stdout
-			logger.Info("Outputting logs to stdout")
-			logger.SetOutput(os.Stdout)
-		}
-	} else {
-		// no logging needed
-		logger.Info("No further logs will be outputted")
-		logger.SetOutput(nil)
+	logFile, err := setUpLogging(startConf.Logging)
+	if err != nil {
+		logger.Error("Failed to create logs file: %s", err)
+		return
 	}
+	defer func() {
+		if reloader.logFile != nil {
+			reloader.logFile.Close()
+		}
+	}()
+	reloader.logFile = logFile
 
 	// launch concurrent scraping !
+	if startConf.Monitor.Enabled {
+		// changes are known only once every page has been visited
+		workerPool.EndWhenIdle()
+	}
 	workerPool.Work()
 	logger.Info("Started scraping...")
 
 	// if logs are not used or are printed to the file - output a nice statistics message on the screen
-	if !conf.Logging.OutputLogs || (conf.Logging.OutputLogs && conf.Logging.LogsFile != "") {
+	if !startConf.Logging.OutputLogs || (startConf.Logging.OutputLogs && startConf.Logging.LogsFile != "") {
 		go func() {
 			var lastPagesVisited uint64 = 0
 			fmt.Printf("\n")
 			for {
 				time.Sleep(time.Second)
 
-				timeSince := time.Since(time.Unix(int64(statistics.StartTimeUnix), 0)).Round(time.Second)
+				current := statistics.Snapshot()
+				timeSince := time.Since(time.Unix(int64(current.StartTimeUnix), 0)).Round(time.Second)
 				fmt.Fprintf(os.Stdout, "\r[%s] %d pages visited; %d pages saved; %d matches (%d pages/sec)",
 					timeSince.String(),
-					statistics.PagesVisited,
-					statistics.PagesSaved,
-					statistics.MatchesFound,
-					statistics.PagesVisited-lastPagesVisited,
+					current.PagesVisited,
+					current.PagesSaved,
+					current.MatchesFound,
+					current.PagesVisited-lastPagesVisited,
 				)
-				lastPagesVisited = statistics.PagesVisited
+				lastPagesVisited = current.PagesVisited
 			}
 		}()
 	}
 
+	// reload configuration on SIGHUP and|or when the file changes
+	go reloader.watch(time.Duration(startConf.ReloadIntervalMs) * time.Millisecond)
+
 	// set up graceful shutdown
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
-	<-sig
-	logger.Info("Received interrupt signal. Exiting...")
-
-	// stop workers
-	workerPool.Stop()
+	select {
+	case <-sig:
+		logger.Info("Received interrupt signal. Exiting...")
+		// stop workers and let them check the pages they are visiting for changes
+		workerPool.Stop()
+		workerPool.Wait()
+		finishMonitors(jobConfs, &statistics, false)
+
+	case <-workerPool.Done():
+		// let the last pages be processed
+		workerPool.Stop()
+		workerPool.Wait()
+		finalStats := workerPool.Statistics()
+		logger.Info(
+			"Finished: %s. %d pages visited; %d pages saved; %d matches; %d bytes downloaded",
+			workerPool.StopReason(),
+			finalStats.PagesVisited,
+			finalStats.PagesSaved,
+			finalStats.MatchesFound,
+			finalStats.BytesDownloaded,
+		)
+		if startConf.Duplicates.Skip {
+			logger.Info(
+				"Skipped %d near-duplicate pages in %d clusters",
+				finalStats.DuplicatesSkipped, len(finalStats.DuplicateClusters),
+			)
+		}
+		finishMonitors(jobConfs, &statistics, workerPool.Complete())
+	}
 }
@@ -0,0 +1,186 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package monitor
+
+import "fmt"
+
+// Texts needing more line additions and removals than that are not diffed line by line,
+// all of their differing lines are reported as replaced instead
+const maxDiffEdits int = 2000
+
+// Furthest reaching paths of Myers' algorithm by diagonal, shared by every search for a middle snake
+type diffPaths struct {
+	forward  []int
+	backward []int
+}
+
+// Find the middle snake of the shortest edit script turning a into b (Myers, "An O(ND) Difference
+// Algorithm and Its Variations", 4b). Returns where it starts and ends in a and b and the number of
+// edits of the whole script, ok is false if there are more than maxEdits of them
+func (p *diffPaths) middleSnake(a []string, b []string, maxEdits int) (x, y, u, v, edits int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	// diagonals are shifted to be valid indices
+	offset := (n+m+1)/2 + 1
+	forward, backward := p.forward[:2*offset+1], p.backward[:2*offset+1]
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	for d := 0; d <= (n+m+1)/2; d++ {
+		if 2*d-1 > maxEdits {
+			return 0, 0, 0, 0, 0, false
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var startX int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				startX = forward[offset+k+1]
+			} else {
+				startX = forward[offset+k-1] + 1
+			}
+			startY := startX - k
+
+			endX, endY := startX, startY
+			for endX < n && endY < m && a[endX] == b[endY] {
+				endX++
+				endY++
+			}
+			forward[offset+k] = endX
+
+			// backward diagonal this one is on
+			backwardK := delta - k
+			if odd && backwardK >= -(d-1) && backwardK <= d-1 && endX >= n-backward[offset+backwardK] {
+				return startX, startY, endX, endY, 2*d - 1, true
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			// counted from the ends of a and b
+			var startX int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				startX = backward[offset+k+1]
+			} else {
+				startX = backward[offset+k-1] + 1
+			}
+			startY := startX - k
+
+			endX, endY := startX, startY
+			for endX < n && endY < m && a[n-1-endX] == b[m-1-endY] {
+				endX++
+				endY++
+			}
+			backward[offset+k] = endX
+
+			forwardK := delta - k
+			if !odd && forwardK >= -d && forwardK <= d && forward[offset+forwardK] >= n-endX {
+				if 2*d > maxEdits {
+					return 0, 0, 0, 0, 0, false
+				}
+				return n - endX, m - endY, n - startX, m - startY, 2 * d, true
+			}
+		}
+	}
+
+	return 0, 0, 0, 0, 0, false
+}
+
+// Mark lines of a and b that belong to their longest common subsequence. Returns false
+// without marking anything if turning a into b takes more than maxEdits line edits
+func (p *diffPaths) common(a []string, b []string, aKept []bool, bKept []bool, maxEdits int) bool {
+	for len(a) != 0 && len(b) != 0 && a[0] == b[0] {
+		aKept[0], bKept[0] = true, true
+		a, b, aKept, bKept = a[1:], b[1:], aKept[1:], bKept[1:]
+	}
+	for len(a) != 0 && len(b) != 0 && a[len(a)-1] == b[len(b)-1] {
+		aKept[len(a)-1], bKept[len(b)-1] = true, true
+		a, b, aKept, bKept = a[:len(a)-1], b[:len(b)-1], aKept[:len(a)-1], bKept[:len(b)-1]
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+
+	x, y, u, v, _, ok := p.middleSnake(a, b, maxEdits)
+	if !ok {
+		return false
+	}
+	for index := x; index < u; index++ {
+		aKept[index] = true
+		bKept[index-x+y] = true
+	}
+
+	// both halves take fewer edits than the whole
+	p.common(a[:x], b[:y], aKept[:x], bKept[:y], maxEdits)
+	p.common(a[u:], b[v:], aKept[u:], bKept[v:], maxEdits)
+
+	return true
+}
+
+// Find differences between old and new lines. Removed lines start with "-", added ones with "+",
+// each group of changes is preceded by "@@ <line>" with the line number of the new text it is at
+func Diff(oldLines []string, newLines []string) []string {
+	var oldKept []bool = make([]bool, len(oldLines))
+	var newKept []bool = make([]bool, len(newLines))
+
+	size := len(oldLines) + len(newLines) + 4
+	paths := diffPaths{
+		forward:  make([]int, size),
+		backward: make([]int, size),
+	}
+	if !paths.common(oldLines, newLines, oldKept, newKept, maxDiffEdits) {
+		// keep only the common beginning and end
+		for index := range oldKept {
+			oldKept[index] = false
+		}
+		for index := range newKept {
+			newKept[index] = false
+		}
+		var prefix int = 0
+		for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+			oldKept[prefix], newKept[prefix] = true, true
+			prefix++
+		}
+		for suffix := 1; suffix <= len(oldLines)-prefix && suffix <= len(newLines)-prefix &&
+			oldLines[len(oldLines)-suffix] == newLines[len(newLines)-suffix]; suffix++ {
+			oldKept[len(oldLines)-suffix], newKept[len(newLines)-suffix] = true, true
+		}
+	}
+
+	// kept lines of old and new text pair up in order
+	var diff []string
+	var oldIndex, newIndex int = 0, 0
+	for oldIndex < len(oldLines) || newIndex < len(newLines) {
+		if oldIndex < len(oldLines) && newIndex < len(newLines) && oldKept[oldIndex] && newKept[newIndex] {
+			oldIndex++
+			newIndex++
+			continue
+		}
+
+		diff = append(diff, fmt.Sprintf("@@ %d", newIndex+1))
+		for oldIndex < len(oldLines) && !oldKept[oldIndex] {
+			diff = append(diff, "-"+oldLines[oldIndex])
+			oldIndex++
+		}
+		for newIndex < len(newLines) && !newKept[newIndex] {
+			diff = append(diff, "+"+newLines[newIndex])
+			newIndex++
+		}
+	}
+
+	return diff
+}
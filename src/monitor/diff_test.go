@@ -0,0 +1,149 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package monitor
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		diff string
+	}{
+		{"same", "a b c", "a b c", ""},
+		{"both empty", "", "", ""},
+		{"added", "", "a b", "@@ 1 +a +b"},
+		{"removed", "a b", "", "@@ 1 -a -b"},
+		{"changed line", "a b c", "a x c", "@@ 2 -b +x"},
+		{"added at the end", "a b", "a b c", "@@ 3 +c"},
+		{"removed at the beginning", "a b c", "b c", "@@ 1 -a"},
+		{"separate changes", "a b c d e", "a x c d y e", "@@ 2 -b +x @@ 5 +y"},
+		{"moved line", "a b c d", "b c d a", "@@ 1 -a @@ 4 +a"},
+		{"repeated lines", "a a b a", "a b a a", "@@ 2 -a @@ 3 +a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := strings.Join(Diff(strings.Fields(test.old), strings.Fields(test.new)), " ")
+			if diff != test.diff {
+				t.Errorf("expected %q, got %q", test.diff, diff)
+			}
+		})
+	}
+}
+
+// Get the number of lines of the longest common subsequence of a and b
+func commonLines(a []string, b []string) int {
+	var previous, current []int = make([]int, len(b)+1), make([]int, len(b)+1)
+	for aIndex := range a {
+		for bIndex := range b {
+			if a[aIndex] == b[bIndex] {
+				current[bIndex+1] = previous[bIndex] + 1
+			} else if previous[bIndex+1] > current[bIndex] {
+				current[bIndex+1] = previous[bIndex+1]
+			} else {
+				current[bIndex+1] = current[bIndex]
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// Turn old lines into new ones following diff
+func applyDiff(t *testing.T, oldLines []string, diff []string) []string {
+	var newLines []string
+	var oldIndex int = 0
+	for _, line := range diff {
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			newLine, err := strconv.Atoi(line[3:])
+			if err != nil {
+				t.Fatalf("invalid hunk header %q", line)
+			}
+			// copy unchanged lines up to the hunk
+			for len(newLines) < newLine-1 {
+				newLines = append(newLines, oldLines[oldIndex])
+				oldIndex++
+			}
+		case strings.HasPrefix(line, "-"):
+			if oldLines[oldIndex] != line[1:] {
+				t.Fatalf("removed line %q is %q in the old text", line[1:], oldLines[oldIndex])
+			}
+			oldIndex++
+		case strings.HasPrefix(line, "+"):
+			newLines = append(newLines, line[1:])
+		}
+	}
+
+	return append(newLines, oldLines[oldIndex:]...)
+}
+
+func TestDiffIsShortest(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLines := func(count int) []string {
+		var lines []string
+		for index := 0; index < count; index++ {
+			lines = append(lines, fmt.Sprint(random.Intn(4)))
+		}
+		return lines
+	}
+
+	for round := 0; round < 500; round++ {
+		oldLines, newLines := randomLines(random.Intn(30)), randomLines(random.Intn(30))
+		diff := Diff(oldLines, newLines)
+
+		if strings.Join(applyDiff(t, oldLines, diff), " ") != strings.Join(newLines, " ") {
+			t.Fatalf("diff of %v and %v does not turn one into the other: %v", oldLines, newLines, diff)
+		}
+
+		var edits int = 0
+		for _, line := range diff {
+			if !strings.HasPrefix(line, "@@ ") {
+				edits++
+			}
+		}
+		if expected := len(oldLines) + len(newLines) - 2*commonLines(oldLines, newLines); edits != expected {
+			t.Fatalf("diff of %v and %v has %d edits instead of %d: %v", oldLines, newLines, edits, expected, diff)
+		}
+	}
+}
+
+func TestDiffTooManyEdits(t *testing.T) {
+	var oldLines, newLines []string = []string{"same"}, []string{"same"}
+	for index := 0; index < maxDiffEdits; index++ {
+		oldLines = append(oldLines, "old "+fmt.Sprint(index))
+		newLines = append(newLines, "new "+fmt.Sprint(index))
+	}
+	oldLines = append(oldLines, "end")
+	newLines = append(newLines, "end")
+
+	diff := Diff(oldLines, newLines)
+	if len(diff) != 2*maxDiffEdits+1 || diff[0] != "@@ 2" || diff[1] != "-old 0" || diff[len(diff)-1] != "+new "+fmt.Sprint(maxDiffEdits-1) {
+		t.Errorf("expected every differing line to be replaced in one hunk, got %d lines starting with %v", len(diff), diff[:3])
+	}
+}
@@ -0,0 +1,310 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/web"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Kinds of changes
+const (
+	ChangeNew     string = "new"
+	ChangeChanged string = "changed"
+	ChangeRemoved string = "removed"
+)
+
+// Default file names in the output directory of a job
+const (
+	DefaultStateFile  string = "monitor_state.json"
+	DefaultOutputFile string = "changes.jsonl"
+)
+
+// What a page looked like when it was visited the last time
+type PageState struct {
+	Hash     string `json:"hash"`
+	Text     string `json:"text"`
+	TimeUnix uint64 `json:"time_unix"`
+}
+
+// Page state file contents
+type state struct {
+	Pages map[string]PageState `json:"pages"`
+}
+
+// A page that has appeared, changed or disappeared since the previous crawl
+type Change struct {
+	Type         string `json:"type"`
+	URL          string `json:"url"`
+	Job          string `json:"job,omitempty"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+	Hash         string `json:"hash,omitempty"`
+	// Changed lines of page text, see Diff
+	Diff     []string `json:"diff,omitempty"`
+	TimeUnix uint64   `json:"time_unix"`
+}
+
+// Compares pages of a crawl job against the previous crawl
+type Monitor struct {
+	job             string
+	statePath       string
+	output          io.Writer
+	ignoreSelectors []cascadia.Selector
+	ignoreRegexps   []*regexp.Regexp
+	previous        map[string]PageState
+	current         map[string]PageState
+	// pages that have failed to be fetched this time
+	failed   map[string]bool
+	finished bool
+	lock     sync.Mutex
+}
+
+// Create a monitor of job that reads the previous crawl from the state file at statePath (if there is one)
+// and writes changes to output
+func New(job string, conf config.Monitor, statePath string, output io.Writer) (*Monitor, error) {
+	var monitor Monitor = Monitor{
+		job:       job,
+		statePath: statePath,
+		output:    output,
+		previous:  make(map[string]PageState),
+		current:   make(map[string]PageState),
+		failed:    make(map[string]bool),
+	}
+
+	for _, selector := range conf.IgnoreSelectors {
+		compiled, err := cascadia.Compile(selector)
+		if err != nil {
+			return nil, err
+		}
+		monitor.ignoreSelectors = append(monitor.ignoreSelectors, compiled)
+	}
+
+	for _, expression := range conf.IgnoreRegexps {
+		compiled, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, err
+		}
+		monitor.ignoreRegexps = append(monitor.ignoreRegexps, compiled)
+	}
+
+	stateFile, err := os.Open(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &monitor, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer stateFile.Close()
+
+	var previous state
+	err = json.NewDecoder(stateFile).Decode(&previous)
+	if err != nil {
+		return nil, err
+	}
+	if previous.Pages != nil {
+		monitor.previous = previous.Pages
+	}
+
+	return &monitor, nil
+}
+
+// Number of pages of the previous crawl
+func (m *Monitor) PreviousPages() int {
+	return len(m.previous)
+}
+
+// Visible text of page without ignored elements and text, whitespace collapsed
+func (m *Monitor) normalize(pageBody []byte) string {
+	if len(m.ignoreSelectors) != 0 {
+		document, err := html.Parse(bytes.NewReader(pageBody))
+		if err == nil {
+			for _, selector := range m.ignoreSelectors {
+				for _, node := range selector.MatchAll(document) {
+					if node.Parent != nil {
+						node.Parent.RemoveChild(node)
+					}
+				}
+			}
+
+			var rendered bytes.Buffer
+			if html.Render(&rendered, document) == nil {
+				pageBody = rendered.Bytes()
+			}
+		}
+	}
+
+	text := string(web.VisibleText(pageBody))
+	if len(m.ignoreRegexps) == 0 {
+		return text
+	}
+
+	for _, re := range m.ignoreRegexps {
+		text = re.ReplaceAllString(text, "")
+	}
+
+	// ignored text may leave empty lines and extra spaces behind
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Split text into lines, none for empty text
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
+
+// Write change to the output as a single JSON line
+func (m *Monitor) write(change Change) error {
+	changeBytes, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.output.Write(append(changeBytes, '\n'))
+	return err
+}
+
+// Compare page at pageURL with what it was during the previous crawl. Returns the change that
+// has been written to the output or nil if the page is the same
+func (m *Monitor) Check(pageURL string, pageBody []byte) (*Change, error) {
+	text := m.normalize(pageBody)
+	hash := sha256.Sum256([]byte(text))
+	pageState := PageState{
+		Hash:     hex.EncodeToString(hash[:]),
+		Text:     text,
+		TimeUnix: uint64(time.Now().Unix()),
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.finished {
+		return nil, nil
+	}
+	m.current[pageURL] = pageState
+
+	previousState, seen := m.previous[pageURL]
+	if seen && previousState.Hash == pageState.Hash {
+		return nil, nil
+	}
+
+	var change Change = Change{
+		Type:     ChangeNew,
+		URL:      pageURL,
+		Job:      m.job,
+		Hash:     pageState.Hash,
+		TimeUnix: pageState.TimeUnix,
+	}
+	if seen {
+		change.Type = ChangeChanged
+		change.PreviousHash = previousState.Hash
+		change.Diff = Diff(splitLines(previousState.Text), splitLines(pageState.Text))
+	}
+
+	return &change, m.write(change)
+}
+
+// Remember that page at pageURL has failed to be fetched (ie: because of a timeout), so it is
+// not reported as removed and its state of the previous crawl is kept
+func (m *Monitor) Failed(pageURL string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.failed[pageURL] = true
+}
+
+// Write down pages of this crawl for the next one. If the crawl is complete, pages of the previous crawl
+// that have not been visited this time are reported as removed, otherwise they are kept as they were.
+// Pages that have failed to be fetched are never reported as removed. Returns removed pages
+func (m *Monitor) Finish(complete bool) ([]Change, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.finished {
+		return nil, nil
+	}
+	m.finished = true
+
+	var removed []Change
+	var removedURLs []string
+	for pageURL := range m.previous {
+		if _, ok := m.current[pageURL]; ok {
+			continue
+		}
+
+		if complete && !m.failed[pageURL] {
+			removedURLs = append(removedURLs, pageURL)
+		} else {
+			m.current[pageURL] = m.previous[pageURL]
+		}
+	}
+
+	sort.Strings(removedURLs)
+	for _, pageURL := range removedURLs {
+		change := Change{
+			Type:         ChangeRemoved,
+			URL:          pageURL,
+			Job:          m.job,
+			PreviousHash: m.previous[pageURL].Hash,
+			TimeUnix:     uint64(time.Now().Unix()),
+		}
+		err := m.write(change)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, change)
+	}
+
+	// replace the state at once so an interrupted write does not lose it
+	stateBytes, err := json.Marshal(state{Pages: m.current})
+	if err != nil {
+		return removed, err
+	}
+
+	err = os.WriteFile(m.statePath+".tmp", stateBytes, 0644)
+	if err != nil {
+		return removed, err
+	}
+
+	return removed, os.Rename(m.statePath+".tmp", m.statePath)
+}
@@ -0,0 +1,167 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package monitor
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unbewohnte/wecr/config"
+)
+
+// Pages of a crawl by URL; a page that fails to be fetched has no body
+type crawl map[string]string
+
+// Run crawls one after another against the same state file, returning changes of the last one
+// as "type url" strings
+func runCrawls(t *testing.T, conf config.Monitor, complete bool, crawls ...crawl) []string {
+	statePath := filepath.Join(t.TempDir(), DefaultStateFile)
+
+	var changes []string
+	for _, pages := range crawls {
+		var output bytes.Buffer
+		monitor, err := New("job", conf, statePath, &output)
+		if err != nil {
+			t.Fatalf("failed to create monitor: %s", err)
+		}
+
+		changes = nil
+		for pageURL, body := range pages {
+			if body == "" {
+				monitor.Failed(pageURL)
+				continue
+			}
+
+			change, err := monitor.Check(pageURL, []byte(body))
+			if err != nil {
+				t.Fatalf("failed to check %s: %s", pageURL, err)
+			}
+			if change != nil {
+				changes = append(changes, change.Type+" "+change.URL)
+			}
+		}
+
+		removed, err := monitor.Finish(complete)
+		if err != nil {
+			t.Fatalf("failed to finish: %s", err)
+		}
+		for _, change := range removed {
+			changes = append(changes, change.Type+" "+change.URL)
+		}
+
+		if strings.Count(output.String(), "\n") != len(changes) {
+			t.Errorf("expected %d lines of changes written, got %q", len(changes), output.String())
+		}
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+func TestMonitor(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     config.Monitor
+		complete bool
+		crawls   []crawl
+		changes  string
+	}{
+		{
+			"first crawl",
+			config.Monitor{}, true,
+			[]crawl{{"/a": "<p>a</p>"}},
+			"new /a",
+		},
+		{
+			"unchanged, changed, new and removed pages",
+			config.Monitor{}, true,
+			[]crawl{
+				{"/same": "<p>same</p>", "/changed": "<p>old</p>", "/removed": "<p>removed</p>"},
+				{"/same": "<p> same </p>", "/changed": "<p>new</p>", "/new": "<p>new</p>"},
+			},
+			"changed /changed,new /new,removed /removed",
+		},
+		{
+			"incomplete crawl removes nothing",
+			config.Monitor{}, false,
+			[]crawl{{"/a": "<p>a</p>", "/b": "<p>b</p>"}, {"/a": "<p>a</p>"}},
+			"",
+		},
+		{
+			"page failing to be fetched is not removed",
+			config.Monitor{}, true,
+			[]crawl{{"/a": "<p>a</p>", "/b": "<p>b</p>"}, {"/a": "<p>a</p>", "/b": ""}, {"/a": "<p>a</p>", "/b": "<p>b</p>"}},
+			"",
+		},
+		{
+			"ignored elements and text",
+			config.Monitor{IgnoreSelectors: []string{".ad"}, IgnoreRegexps: []string{`\d\d:\d\d`}}, true,
+			[]crawl{
+				{"/a": `<p>news at 10:15</p><div class="ad">buy</div>`},
+				{"/a": `<p>news at 11:30</p><div class="ad">sell</div>`},
+			},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := strings.Join(runCrawls(t, test.conf, test.complete, test.crawls...), ",")
+			if changes != test.changes {
+				t.Errorf("expected changes %q, got %q", test.changes, changes)
+			}
+		})
+	}
+}
+
+func TestMonitorChangeDiff(t *testing.T) {
+	var output bytes.Buffer
+	statePath := filepath.Join(t.TempDir(), DefaultStateFile)
+
+	for _, body := range []string{"<p>one</p><p>two</p>", "<p>one</p><p>three</p>"} {
+		monitor, err := New("job", config.Monitor{}, statePath, &output)
+		if err != nil {
+			t.Fatalf("failed to create monitor: %s", err)
+		}
+
+		change, err := monitor.Check("/a", []byte(body))
+		if err != nil {
+			t.Fatalf("failed to check: %s", err)
+		}
+		if change != nil && change.Type == ChangeChanged {
+			if strings.Join(change.Diff, " ") != "@@ 2 -two +three" {
+				t.Errorf("unexpected diff %q", change.Diff)
+			}
+			if change.PreviousHash == "" || change.PreviousHash == change.Hash {
+				t.Errorf("expected hashes to differ, got %s and %s", change.PreviousHash, change.Hash)
+			}
+		}
+
+		_, err = monitor.Finish(true)
+		if err != nil {
+			t.Fatalf("failed to finish: %s", err)
+		}
+	}
+
+	if !strings.Contains(output.String(), `"type":"changed"`) {
+		t.Errorf("expected a change to be written, got %q", output.String())
+	}
+}
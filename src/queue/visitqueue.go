@@ -1,12 +1,239 @@
 package queue
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"os"
+	"sync"
 	"unbewohnte/wecr/web"
 )
 
+// Queue of jobs to visit. Jobs are either offloaded to a file or kept in memory.
+// A file queue is visited last in, first out (the newest links first) and grows as big as it needs to,
+// a memory one is visited first in, first out and holds no more than its capacity
+type VisitQueue struct {
+	file     *os.File
+	jobs     []web.Job
+	capacity int
+	lock     sync.Mutex
+	// signalled when a job has been taken out of a memory queue
+	taken *sync.Cond
+}
+
+// Create a new visit queue that stores its jobs in file
+func NewFileQueue(file *os.File) *VisitQueue {
+	return &VisitQueue{
+		file: file,
+		jobs: nil,
+	}
+}
+
+// Create a new visit queue that stores no more than capacity of jobs in memory
+func NewMemoryQueue(capacity int) *VisitQueue {
+	queue := &VisitQueue{
+		file:     nil,
+		jobs:     nil,
+		capacity: capacity,
+	}
+	queue.taken = sync.NewCond(&queue.lock)
+
+	return queue
+}
+
+// Add a new job to the queue. Waits for a free place if memory queue is full
+func (q *VisitQueue) Push(job web.Job) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file != nil {
+		return InsertNewJob(q.file, job)
+	}
+
+	for len(q.jobs) >= q.capacity {
+		q.taken.Wait()
+	}
+
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+// Put a job that has been taken out of the queue back without waiting, even if memory queue is full.
+// The job is visited next
+func (q *VisitQueue) PushBack(job web.Job) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file != nil {
+		return InsertNewJob(q.file, job)
+	}
+
+	q.jobs = append([]web.Job{job}, q.jobs...)
+	return nil
+}
+
+// Take the next job out of the queue. Returns nil job if the queue is empty
+func (q *VisitQueue) Pop() (*web.Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file != nil {
+		return PopLastJob(q.file)
+	}
+
+	if len(q.jobs) == 0 {
+		return nil, nil
+	}
+
+	job := q.jobs[0]
+	q.jobs[0] = web.Job{}
+	q.jobs = q.jobs[1:]
+	q.taken.Signal()
+
+	return &job, nil
+}
+
+// Check whether there are no jobs in the queue
+func (q *VisitQueue) IsEmpty() (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file != nil {
+		stats, err := q.file.Stat()
+		if err != nil {
+			return false, err
+		}
+		return stats.Size() == 0, nil
+	}
+
+	return len(q.jobs) == 0, nil
+}
+
+// Get all queued jobs in the order they are going to be visited
+func (q *VisitQueue) Jobs() ([]web.Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file != nil {
+		jobs, err := readAllJobs(q.file)
+		if err != nil {
+			return nil, err
+		}
+
+		// jobs are popped from the end of the file
+		for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+			jobs[i], jobs[j] = jobs[j], jobs[i]
+		}
+
+		return jobs, nil
+	}
+
+	jobs := make([]web.Job, len(q.jobs))
+	copy(jobs, q.jobs)
+
+	return jobs, nil
+}
+
+// Get the number of queued jobs
+func (q *VisitQueue) Size() (uint64, error) {
+	if q.file == nil {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		return uint64(len(q.jobs)), nil
+	}
+
+	jobs, err := q.Jobs()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(jobs)), nil
+}
+
+// Remove every queued job for which shouldRemove returns true. Returns the number of removed jobs
+func (q *VisitQueue) Remove(shouldRemove func(web.Job) bool) (uint64, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var jobs []web.Job
+	if q.file != nil {
+		var err error
+		jobs, err = readAllJobs(q.file)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		jobs = q.jobs
+	}
+
+	var keptJobs []web.Job
+	var removed uint64 = 0
+	for _, job := range jobs {
+		if shouldRemove(job) {
+			removed++
+			continue
+		}
+		keptJobs = append(keptJobs, job)
+	}
+
+	if q.file == nil {
+		q.jobs = keptJobs
+		q.taken.Broadcast()
+		return removed, nil
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// rewrite the whole file with jobs that are left at once, the queue stays locked till the end
+	var rewritten bytes.Buffer
+	encoder := json.NewEncoder(&rewritten)
+	for _, job := range keptJobs {
+		err := encoder.Encode(&job)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err := q.file.Truncate(0)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = q.file.WriteAt(rewritten.Bytes(), 0)
+	if err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+// Decode every job in the queue file from start to end
+func readAllJobs(queue *os.File) ([]web.Job, error) {
+	_, err := queue.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []web.Job
+	decoder := json.NewDecoder(queue)
+	for {
+		var job web.Job
+		err = decoder.Decode(&job)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
 func PopLastJob(queue *os.File) (*web.Job, error) {
 	stats, err := queue.Stat()
 	if err != nil {
@@ -28,7 +255,7 @@ func PopLastJob(queue *os.File) (*web.Job, error) {
 
 		decoder := json.NewDecoder(queue)
 		err = decoder.Decode(&job)
-		if err != nil || job.URL == "" || job.Search.Query == "" {
+		if err != nil || job.URL == "" || job.Depth == 0 {
 			offset -= 1
 			continue
 		}
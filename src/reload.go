@@ -0,0 +1,203 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/logger"
+	"unbewohnte/wecr/scope"
+	"unbewohnte/wecr/worker"
+)
+
+// Applies changes of configuration file to the running crawl
+type configReloader struct {
+	conf       *config.Conf
+	workerConf *worker.WorkerConf
+	logFile    *logger.RotatingFile
+	lock       sync.Mutex
+}
+
+// Reload configuration on SIGHUP and, if interval is not 0, whenever the file's
+// modification time changes
+func (r *configReloader) watch(interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	var ticks <-chan time.Time
+	var lastModified time.Time
+	if interval > 0 {
+		ticks = time.NewTicker(interval).C
+		if stats, err := os.Stat(configFilePath); err == nil {
+			lastModified = stats.ModTime()
+		}
+	}
+
+	for {
+		select {
+		case <-hangup:
+			logger.Info("Received SIGHUP")
+			r.reload()
+
+		case <-ticks:
+			stats, err := os.Stat(configFilePath)
+			if err != nil || stats.ModTime().Equal(lastModified) {
+				continue
+			}
+			lastModified = stats.ModTime()
+			logger.Info("Configuration file has been changed")
+			r.reload()
+		}
+	}
+}
+
+// Read configuration file again, layering the same overrides on top, and apply the changes
+// that are safe to make while crawling. The rest are logged as requiring a restart
+func (r *configReloader) reload() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	logger.Info("Reloading configuration file \"%s\"", configFilePath)
+
+	newConf, err := config.OpenConfigFile(configFilePath)
+	if err != nil {
+		logger.Error("Failed to reload configuration file: %s. Keeping the current configuration", err)
+		return
+	}
+
+	err = newConf.ApplyEnv(os.Environ())
+	if err == nil {
+		err = flagOverrides.Apply(newConf)
+	}
+	if err != nil {
+		logger.Error("Failed to apply overrides to reloaded configuration: %s. Keeping the current configuration", err)
+		return
+	}
+
+	var currentConf config.Conf
+	r.workerConf.View(func() {
+		currentConf = *r.conf
+	})
+
+	if newConf.Requests.UserAgent == "" {
+		// keep the forced one without warning about it again
+		newConf.Requests.UserAgent = currentConf.Requests.UserAgent
+	}
+	prepareConf(newConf)
+
+	err = newConf.Validate()
+	if err != nil {
+		logger.Error("Reloaded configuration is invalid, keeping the current one:")
+		for _, problem := range err.(config.ValidationErrors) {
+			logger.Error("%s", problem)
+		}
+		return
+	}
+
+	changes := config.Diff(&currentConf, newConf)
+	if len(changes) == 0 {
+		logger.Info("Configuration has not changed")
+		return
+	}
+
+	var patched config.Conf = currentConf
+	var logOutputChanged bool = false
+	var liveChanges uint = 0
+	for _, change := range changes {
+		if !change.Live() {
+			logger.Warning("%s requires a restart to take effect", change)
+			continue
+		}
+		liveChanges++
+		logger.Info("Applying %s", change)
+
+		if strings.HasPrefix(change.Path, "logging.") &&
+			change.Path != "logging.level" && change.Path != "logging.format" {
+			logOutputChanged = true
+		}
+	}
+
+	if liveChanges == 0 {
+		return
+	}
+
+	patched.Search = newConf.Search
+	patched.Requests = newConf.Requests
+	patched.AllowedDomains = newConf.AllowedDomains
+	patched.BlacklistedDomains = newConf.BlacklistedDomains
+	patched.Scope = newConf.Scope
+	patched.Logging = newConf.Logging
+	if len(patched.Jobs) == len(newConf.Jobs) {
+		patched.Jobs = append([]config.Job(nil), patched.Jobs...)
+		for index := range patched.Jobs {
+			patched.Jobs[index].Search = newConf.Jobs[index].Search
+			patched.Jobs[index].AllowedDomains = newConf.Jobs[index].AllowedDomains
+			patched.Jobs[index].BlacklistedDomains = newConf.Jobs[index].BlacklistedDomains
+			patched.Jobs[index].Scope = newConf.Jobs[index].Scope
+		}
+	}
+
+	// workers hold pointers to parts of conf, so change it in place while they wait
+	r.workerConf.Reconfigure(func() {
+		*r.conf = patched
+		for _, crawlJob := range patched.CrawlJobs() {
+			jobConf, ok := r.workerConf.Jobs[crawlJob.Name]
+			if !ok {
+				continue
+			}
+
+			*jobConf.Search = crawlJob.Search
+			err := openSearchOutputs(jobConf, crawlJob.Search, true)
+			if err != nil {
+				logger.Error("Failed to open search output file: %s", err)
+			}
+			rules, err := scope.New(crawlJob.Scope, crawlJob.AllowedDomains, crawlJob.BlacklistedDomains)
+			if err != nil {
+				logger.Error("Invalid scope rules: %s", err)
+				continue
+			}
+			jobConf.Scope = rules
+		}
+	})
+
+	if !logOutputChanged {
+		logLevel, _ := logger.ParseLevel(patched.Logging.Level)
+		logger.SetLevel(logLevel)
+		logFormat, _ := logger.ParseFormat(patched.Logging.Format)
+		logger.SetFormat(logFormat)
+	} else {
+		logFile, err := setUpLogging(patched.Logging)
+		if err != nil {
+			logger.Error("Failed to create logs file: %s. Outputting logs to stdout", err)
+			logger.SetOutput(os.Stdout)
+		}
+
+		if r.logFile != nil {
+			r.logFile.Close()
+		}
+		r.logFile = logFile
+	}
+
+	logger.Info("Applied %d configuration changes", liveChanges)
+}
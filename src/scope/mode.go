@@ -0,0 +1,59 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package scope
+
+import (
+	"net/url"
+	"strings"
+	"unbewohnte/wecr/config"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Get registrable domain of host (ie: "wikipedia.org" for "en.wikipedia.org").
+// IP addresses and hosts without a known public suffix are returned as is
+func RegistrableDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+
+	return domain
+}
+
+// Check whether link is on the same site as seed according to crawl mode.
+// Every link is on site if mode is "any" or there is no seed
+func SameSite(mode string, link *url.URL, seed *url.URL) bool {
+	if seed == nil {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case config.CrawlModeSameHost:
+		return strings.EqualFold(link.Host, seed.Host)
+
+	case config.CrawlModeSameDomain:
+		return RegistrableDomain(link.Hostname()) == RegistrableDomain(seed.Hostname())
+
+	default:
+		return true
+	}
+}
@@ -0,0 +1,225 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package scope
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unbewohnte/wecr/config"
+)
+
+// Compiled scope rule
+type Rule struct {
+	// Where the rule comes from, ie: "scope[2]" or "allowed_domains[0]"
+	Source string
+	Allow  bool
+	host   *regexp.Regexp
+	// whether host pattern includes port
+	hostPort   bool
+	pathPrefix string
+	regexp     *regexp.Regexp
+}
+
+func (r Rule) String() string {
+	if r.Allow {
+		return fmt.Sprintf("%s (%s)", r.Source, config.ScopeAllow)
+	}
+
+	return fmt.Sprintf("%s (%s)", r.Source, config.ScopeDeny)
+}
+
+// Check whether every condition of the rule holds for link
+func (r *Rule) matches(link *url.URL) bool {
+	if r.host != nil {
+		host := link.Hostname()
+		if r.hostPort {
+			host = link.Host
+		}
+
+		if !r.host.MatchString(strings.ToLower(host)) {
+			return false
+		}
+	}
+
+	if r.pathPrefix != "" {
+		linkPath := link.Path
+		if linkPath == "" {
+			linkPath = "/"
+		}
+
+		if !strings.HasPrefix(linkPath, r.pathPrefix) {
+			return false
+		}
+	}
+
+	if r.regexp != nil && !r.regexp.MatchString(link.String()) {
+		return false
+	}
+
+	return true
+}
+
+// Ordered scope rules of a crawl job
+type Rules struct {
+	rules []Rule
+	// whether URLs that match no rule are crawled
+	allowByDefault bool
+}
+
+// Compile host pattern with "*" wildcards
+func compileHost(pattern string, includeSubdomains bool) *regexp.Regexp {
+	var expression string = strings.ReplaceAll(
+		regexp.QuoteMeta(strings.ToLower(strings.TrimSpace(pattern))),
+		`\*`, `.*`,
+	)
+	if includeSubdomains {
+		expression = `(.*\.)?` + expression
+	}
+
+	return regexp.MustCompile("^" + expression + "$")
+}
+
+// Compile scope rule that comes from source
+func Compile(rule config.ScopeRule, source string) (Rule, error) {
+	var compiled Rule = Rule{
+		Source:     source,
+		pathPrefix: rule.PathPrefix,
+	}
+
+	switch strings.ToLower(strings.TrimSpace(rule.Action)) {
+	case config.ScopeAllow:
+		compiled.Allow = true
+	case config.ScopeDeny:
+		compiled.Allow = false
+	default:
+		return compiled, fmt.Errorf(
+			"unknown action \"%s\" (must be \"%s\" or \"%s\")", rule.Action, config.ScopeAllow, config.ScopeDeny,
+		)
+	}
+
+	if rule.Host == "" && rule.PathPrefix == "" && rule.Regexp == "" {
+		return compiled, fmt.Errorf("rule has no conditions; set host, path_prefix or regexp")
+	}
+
+	if rule.Host != "" {
+		if strings.Contains(rule.Host, "/") {
+			return compiled, fmt.Errorf("host \"%s\" must not contain scheme or path", rule.Host)
+		}
+		compiled.host = compileHost(rule.Host, rule.IncludeSubdomains)
+		compiled.hostPort = strings.Contains(rule.Host, ":")
+	}
+
+	if rule.Regexp != "" {
+		re, err := regexp.Compile(rule.Regexp)
+		if err != nil {
+			return compiled, fmt.Errorf("invalid regexp: %s", err)
+		}
+		compiled.regexp = re
+	}
+
+	return compiled, nil
+}
+
+// Turn domain URL (ie: "https://en.wikipedia.org") into a rule that matches its host exactly
+func domainRule(domain string, allow bool, source string) (Rule, bool) {
+	parsedURL, err := url.Parse(strings.TrimSpace(domain))
+	if err != nil || parsedURL.Host == "" {
+		return Rule{}, false
+	}
+
+	return Rule{
+		Source:   source,
+		Allow:    allow,
+		host:     regexp.MustCompile("^" + regexp.QuoteMeta(strings.ToLower(parsedURL.Host)) + "$"),
+		hostPort: true,
+	}, true
+}
+
+// Compile scope rules of a crawl job. Explicit rules go first, then blacklisted domains
+// and allowed domains. URLs matching no rule are crawled only if there are no allow rules
+func New(rules []config.ScopeRule, allowedDomains []string, blacklistedDomains []string) (*Rules, error) {
+	var compiled Rules = Rules{
+		allowByDefault: true,
+	}
+
+	for index, rule := range rules {
+		source := fmt.Sprintf("scope[%d]", index)
+		compiledRule, err := Compile(rule, source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", source, err)
+		}
+		compiled.rules = append(compiled.rules, compiledRule)
+	}
+
+	for index, domain := range blacklistedDomains {
+		rule, ok := domainRule(domain, false, fmt.Sprintf("blacklisted_domains[%d]", index))
+		if ok {
+			compiled.rules = append(compiled.rules, rule)
+		}
+	}
+
+	for index, domain := range allowedDomains {
+		rule, ok := domainRule(domain, true, fmt.Sprintf("allowed_domains[%d]", index))
+		if ok {
+			compiled.rules = append(compiled.rules, rule)
+		}
+	}
+
+	for _, rule := range compiled.rules {
+		if rule.Allow {
+			compiled.allowByDefault = false
+			break
+		}
+	}
+
+	return &compiled, nil
+}
+
+// Decide whether link is in scope. Returns the rule that decided it or nil
+// if none matched and the default has been applied
+func (r *Rules) Match(link *url.URL) (bool, *Rule) {
+	for index := range r.rules {
+		if r.rules[index].matches(link) {
+			return r.rules[index].Allow, &r.rules[index]
+		}
+	}
+
+	return r.allowByDefault, nil
+}
+
+// Tell whether link is in scope and why
+func (r *Rules) Explain(link *url.URL) string {
+	allowed, rule := r.Match(link)
+
+	var verdict string = "denied"
+	if allowed {
+		verdict = "allowed"
+	}
+
+	if rule == nil {
+		if r.allowByDefault {
+			return verdict + ": no rule matched and there are no allow rules"
+		}
+		return verdict + ": no rule matched"
+	}
+
+	return fmt.Sprintf("%s by %s", verdict, rule)
+}
@@ -0,0 +1,183 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package scope
+
+import (
+	"net/url"
+	"testing"
+	"unbewohnte/wecr/config"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("invalid test URL %s: %s", rawURL, err)
+	}
+
+	return parsedURL
+}
+
+func TestRulesMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []config.ScopeRule
+		allowed     []string
+		blacklisted []string
+		link        string
+		allow       bool
+		source      string
+	}{
+		{"no rules", nil, nil, nil, "https://example.org/a", true, ""},
+		{
+			"first matching rule wins",
+			[]config.ScopeRule{
+				{Action: config.ScopeDeny, PathPrefix: "/private"},
+				{Action: config.ScopeAllow, Host: "example.org"},
+			},
+			nil, nil, "https://example.org/private/a", false, "scope[0]",
+		},
+		{
+			"later rule applies when earlier does not match",
+			[]config.ScopeRule{
+				{Action: config.ScopeDeny, PathPrefix: "/private"},
+				{Action: config.ScopeAllow, Host: "example.org"},
+			},
+			nil, nil, "https://example.org/public", true, "scope[1]",
+		},
+		{
+			"unmatched link is denied when there are allow rules",
+			[]config.ScopeRule{{Action: config.ScopeAllow, Host: "example.org"}},
+			nil, nil, "https://example.com/", false, "",
+		},
+		{
+			"unmatched link is allowed when there are only deny rules",
+			[]config.ScopeRule{{Action: config.ScopeDeny, Host: "example.org"}},
+			nil, nil, "https://example.com/", true, "",
+		},
+		{
+			"subdomains",
+			[]config.ScopeRule{{Action: config.ScopeDeny, Host: "example.org", IncludeSubdomains: true}},
+			nil, nil, "https://en.example.org/", false, "scope[0]",
+		},
+		{
+			"host without subdomains",
+			[]config.ScopeRule{{Action: config.ScopeDeny, Host: "example.org"}},
+			nil, nil, "https://en.example.org/", true, "",
+		},
+		{
+			"host wildcard",
+			[]config.ScopeRule{{Action: config.ScopeDeny, Host: "*.example.org"}},
+			nil, nil, "https://EN.example.org/", false, "scope[0]",
+		},
+		{
+			"every condition must hold",
+			[]config.ScopeRule{{Action: config.ScopeDeny, Host: "example.org", Regexp: `\.pdf$`}},
+			nil, nil, "https://example.org/a.html", true, "",
+		},
+		{
+			"explicit rules go before blacklisted domains",
+			[]config.ScopeRule{{Action: config.ScopeAllow, PathPrefix: "/docs"}},
+			nil, []string{"https://example.org"}, "https://example.org/docs/", true, "scope[0]",
+		},
+		{
+			"blacklisted domains go before allowed domains",
+			nil, []string{"https://example.org"}, []string{"https://example.org"},
+			"https://example.org/", false, "blacklisted_domains[0]",
+		},
+		{
+			"allowed domain",
+			nil, []string{"", "https://example.org"}, nil, "https://example.org/", true, "allowed_domains[1]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := New(test.rules, test.allowed, test.blacklisted)
+			if err != nil {
+				t.Fatalf("failed to compile rules: %s", err)
+			}
+
+			allow, rule := rules.Match(mustParse(t, test.link))
+			if allow != test.allow {
+				t.Errorf("expected allow = %v, got %v", test.allow, allow)
+			}
+
+			var source string
+			if rule != nil {
+				source = rule.Source
+			}
+			if source != test.source {
+				t.Errorf("expected decision by %q, got %q", test.source, source)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.ScopeRule
+	}{
+		{"unknown action", config.ScopeRule{Action: "maybe", Host: "example.org"}},
+		{"no conditions", config.ScopeRule{Action: config.ScopeAllow}},
+		{"host with scheme", config.ScopeRule{Action: config.ScopeAllow, Host: "https://example.org"}},
+		{"invalid regexp", config.ScopeRule{Action: config.ScopeAllow, Regexp: "("}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Compile(test.rule, "scope[0]")
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	tests := []struct {
+		mode     string
+		link     string
+		seed     string
+		sameSite bool
+	}{
+		{config.CrawlModeAny, "https://example.com/", "https://example.org/", true},
+		{config.CrawlModeSameHost, "https://example.org/a", "https://EXAMPLE.org/", true},
+		{config.CrawlModeSameHost, "https://en.example.org/", "https://example.org/", false},
+		{config.CrawlModeSameHost, "https://example.org:8080/", "https://example.org/", false},
+		{config.CrawlModeSameDomain, "https://en.example.org/", "https://de.example.org/", true},
+		{config.CrawlModeSameDomain, "https://a.example.co.uk/", "https://b.example.co.uk/", true},
+		{config.CrawlModeSameDomain, "https://one.co.uk/", "https://two.co.uk/", false},
+		{config.CrawlModeSameDomain, "https://example.org:8080/", "https://example.org/", true},
+		{" Same_Host ", "https://example.com/", "https://example.org/", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode+" "+test.link, func(t *testing.T) {
+			sameSite := SameSite(test.mode, mustParse(t, test.link), mustParse(t, test.seed))
+			if sameSite != test.sameSite {
+				t.Errorf("expected %v, got %v", test.sameSite, sameSite)
+			}
+		})
+	}
+
+	if !SameSite(config.CrawlModeSameHost, mustParse(t, "https://example.com/"), nil) {
+		t.Errorf("expected every link to be on site without a seed")
+	}
+}
@@ -0,0 +1,234 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/logger"
+	"unbewohnte/wecr/web"
+)
+
+// How deep sitemap indexes can be nested
+const maxSitemapDepth uint = 3
+
+// Gathers initial pages of a crawl job from every seed source
+type seedCollector struct {
+	requests config.Requests
+	log      logger.FieldLogger
+	seeds    []string
+	seen     map[string]bool
+	sitemaps map[string]bool
+}
+
+// Add seed unless it has been added already. Seeds that are not absolute http(s) URLs are skipped
+// the same way initial pages are rejected by validation, returns false for them
+func (s *seedCollector) add(seed string) bool {
+	seed = strings.TrimSpace(seed)
+	if seed == "" || s.seen[seed] {
+		return true
+	}
+
+	_, err := config.ParseAbsoluteURL(seed)
+	if err != nil {
+		s.log.Debug("Skipped seed \"%s\": %s", seed, err)
+		return false
+	}
+
+	s.seen[seed] = true
+	s.seeds = append(s.seeds, seed)
+	return true
+}
+
+// Add every seed of source, warning about the ones that are not absolute http(s) URLs.
+// Returns the number of added seeds
+func (s *seedCollector) addAll(seeds []string, source string) int {
+	var skipped int = 0
+	for _, seed := range seeds {
+		if !s.add(seed) {
+			skipped++
+		}
+	}
+
+	if skipped > 0 {
+		s.log.Warning("Skipped %d seeds of %s that are not absolute http(s) URLs", skipped, source)
+	}
+
+	return len(seeds) - skipped
+}
+
+// Add URLs listed in file, one per line. "-" is standard input
+func (s *seedCollector) readFile(path string) {
+	var input io.Reader = os.Stdin
+	var name string = "standard input"
+	if strings.TrimSpace(path) != config.SeedsStdin {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workingDirectory, path)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			s.log.Error("Failed to open seed file: %s", err)
+			return
+		}
+		defer file.Close()
+		input = file
+		name = path
+	}
+
+	urls, err := web.ReadURLList(input)
+	if err != nil {
+		s.log.Error("Failed to read seeds from %s: %s", name, err)
+	}
+
+	added := s.addAll(urls, name)
+	s.log.Info("Loaded %d seeds from %s", added, name)
+}
+
+// Add pages of sitemap, going into nested sitemaps of an index
+func (s *seedCollector) readSitemap(sitemapURL string, depth uint) {
+	if s.sitemaps[sitemapURL] {
+		return
+	}
+	s.sitemaps[sitemapURL] = true
+
+	data, err := web.GetPage(sitemapURL, s.requests.UserAgent, s.requests.RequestWaitTimeoutMs)
+	if err != nil {
+		s.log.Error("Failed to get sitemap %s: %s", sitemapURL, err)
+		return
+	}
+
+	pages, sitemaps, err := web.ParseSitemap(data)
+	if err != nil {
+		s.log.Error("Failed to parse sitemap %s: %s", sitemapURL, err)
+		return
+	}
+
+	added := s.addAll(pages, "sitemap "+sitemapURL)
+	if added > 0 {
+		s.log.Info("Loaded %d seeds from sitemap %s", added, sitemapURL)
+	}
+
+	if len(sitemaps) > 0 && depth >= maxSitemapDepth {
+		s.log.Warning("Ignored %d sitemaps of %s: sitemap indexes are nested too deep", len(sitemaps), sitemapURL)
+		return
+	}
+	for _, sitemap := range sitemaps {
+		s.readSitemap(sitemap, depth+1)
+	}
+}
+
+// Add links of RSS or Atom feed
+func (s *seedCollector) readFeed(feedURL string) {
+	parsedURL, err := url.Parse(feedURL)
+	if err != nil {
+		s.log.Error("Failed to parse feed URL %s: %s", feedURL, err)
+		return
+	}
+
+	data, err := web.GetPage(feedURL, s.requests.UserAgent, s.requests.RequestWaitTimeoutMs)
+	if err != nil {
+		s.log.Error("Failed to get feed %s: %s", feedURL, err)
+		return
+	}
+
+	links, err := web.ParseFeed(data, *parsedURL)
+	if err != nil {
+		s.log.Error("Failed to parse feed %s: %s", feedURL, err)
+		return
+	}
+
+	added := s.addAll(links, "feed "+feedURL)
+	s.log.Info("Loaded %d seeds from feed %s", added, feedURL)
+}
+
+// Find sitemaps announced in robots.txt of every host of pages
+func (s *seedCollector) discoverSitemaps(pages []string) []string {
+	var sitemaps []string
+	var checkedHosts map[string]bool = make(map[string]bool)
+	for _, page := range pages {
+		pageURL, err := url.Parse(page)
+		if err != nil || pageURL.Host == "" || checkedHosts[pageURL.Host] {
+			continue
+		}
+		checkedHosts[pageURL.Host] = true
+
+		robotsURL := url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: "/robots.txt"}
+		robotsTxt, err := web.GetPage(robotsURL.String(), s.requests.UserAgent, s.requests.RequestWaitTimeoutMs)
+		if err != nil {
+			s.log.Warning("Failed to get %s: %s", robotsURL.String(), err)
+			continue
+		}
+
+		announced := web.FindRobotsSitemaps(robotsTxt)
+		if len(announced) > 0 {
+			s.log.Info("Found %d sitemaps in %s", len(announced), robotsURL.String())
+		}
+		sitemaps = append(sitemaps, announced...)
+	}
+
+	return sitemaps
+}
+
+// Get initial pages of crawl job from initial_pages and every seed source, without duplicates
+func collectSeeds(crawlJob config.Job, requests config.Requests) []string {
+	var fields logger.Fields = logger.Fields{}
+	if crawlJob.Name != "" {
+		fields["job"] = crawlJob.Name
+	}
+
+	collector := seedCollector{
+		requests: requests,
+		log:      logger.With(fields),
+		seen:     make(map[string]bool),
+		sitemaps: make(map[string]bool),
+	}
+
+	for _, initialPage := range crawlJob.InitialPages {
+		collector.add(initialPage)
+	}
+
+	for _, seedFile := range crawlJob.Seeds.Files {
+		if strings.TrimSpace(seedFile) != "" {
+			collector.readFile(seedFile)
+		}
+	}
+
+	var sitemaps []string = crawlJob.Seeds.Sitemaps
+	if crawlJob.Seeds.DiscoverSitemaps {
+		sitemaps = append(collector.discoverSitemaps(collector.seeds), sitemaps...)
+	}
+	for _, sitemap := range sitemaps {
+		if strings.TrimSpace(sitemap) != "" {
+			collector.readSitemap(strings.TrimSpace(sitemap), 1)
+		}
+	}
+
+	for _, feed := range crawlJob.Seeds.Feeds {
+		if strings.TrimSpace(feed) != "" {
+			collector.readFeed(strings.TrimSpace(feed))
+		}
+	}
+
+	return collector.seeds
+}
@@ -0,0 +1,167 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// matches <h1>...</h1> through <h6>...</h6>
+var headingRegexp *regexp.Regexp = regexp.MustCompile(`(?is)<h[1-6][^>]*>(.*?)</h[1-6]\s*>`)
+
+// matches opening tags, capturing tag name
+var openingTagRegexp *regexp.Regexp = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9]*)[^>]*>`)
+
+// matches any tag
+var anyTagRegexp *regexp.Regexp = regexp.MustCompile(`<[^>]*>`)
+
+var whitespaceRegexp *regexp.Regexp = regexp.MustCompile(`\s+`)
+
+// Where and among what a match has been found on page
+type Match struct {
+	Text string `json:"text"`
+	// Up to N characters of the page before and after the match without tags
+	Before string `json:"before"`
+	After  string `json:"after"`
+	// Line of the page the match starts on, starting from 1. Not set for matches in page URL
+	Line int `json:"line,omitempty"`
+	// Text of the nearest heading above the match
+	Heading string `json:"heading,omitempty"`
+	// Name of the nearest element the match follows, ie: "p"
+	Element string `json:"element,omitempty"`
+}
+
+// Collapse whitespace into single spaces
+func collapseWhitespace(text string) string {
+	return whitespaceRegexp.ReplaceAllString(text, " ")
+}
+
+// Remove tags from context text, including the ones cut in half at its edges
+func stripTags(text string) string {
+	if end := strings.Index(text, ">"); end != -1 && !strings.Contains(text[:end], "<") {
+		text = text[end+1:]
+	}
+	if start := strings.LastIndex(text, "<"); start != -1 && !strings.Contains(text[start:], ">") {
+		text = text[:start]
+	}
+
+	return collapseWhitespace(anyTagRegexp.ReplaceAllString(text, " "))
+}
+
+// Get up to count characters that precede offset
+func charsBefore(data []byte, offset int, count uint) string {
+	var start int = offset
+	for taken := uint(0); taken < count && start > 0; taken++ {
+		_, size := utf8.DecodeLastRune(data[:start])
+		start -= size
+	}
+
+	return string(data[start:offset])
+}
+
+// Get up to count characters that follow offset
+func charsAfter(data []byte, offset int, count uint) string {
+	var end int = offset
+	for taken := uint(0); taken < count && end < len(data); taken++ {
+		_, size := utf8.DecodeRune(data[end:])
+		end += size
+	}
+
+	return string(data[offset:end])
+}
+
+// Get contexts of matches at locations on page (pairs of start and end offsets in order)
+func MatchContexts(pageBody []byte, locations [][]int, contextChars uint) []Match {
+	headings := headingRegexp.FindAllSubmatchIndex(pageBody, -1)
+	tags := openingTagRegexp.FindAllSubmatchIndex(pageBody, -1)
+
+	var matches []Match
+	var line int = 1
+	var lineCountedTo int = 0
+	var headingIndex int = -1
+	var tagIndex int = -1
+	for _, location := range locations {
+		start, end := location[0], location[1]
+
+		line += bytes.Count(pageBody[lineCountedTo:start], []byte("\n"))
+		lineCountedTo = start
+
+		// matches come in order, so do headings and tags
+		for headingIndex+1 < len(headings) && headings[headingIndex+1][1] <= start {
+			headingIndex++
+		}
+		for tagIndex+1 < len(tags) && tags[tagIndex+1][1] <= start {
+			tagIndex++
+		}
+
+		match := Match{
+			Text:   string(pageBody[start:end]),
+			Before: stripTags(charsBefore(pageBody, start, contextChars)),
+			After:  stripTags(charsAfter(pageBody, end, contextChars)),
+			Line:   line,
+		}
+
+		if headingIndex >= 0 {
+			heading := pageBody[headings[headingIndex][2]:headings[headingIndex][3]]
+			match.Heading = strings.TrimSpace(collapseWhitespace(anyTagRegexp.ReplaceAllString(string(heading), "")))
+		}
+
+		if tagIndex >= 0 {
+			match.Element = strings.ToLower(string(pageBody[tags[tagIndex][2]:tags[tagIndex][3]]))
+		}
+
+		matches = append(matches, match)
+	}
+
+	return matches
+}
+
+// Get contexts of matches at locations in text extracted from a page (see VisibleTextOrigins).
+// Lines, headings and elements of matches are the ones of the page their text comes from
+func TextMatchContexts(text []byte, origins []TextOrigin, locations [][]int, contextChars uint) []Match {
+	var matches []Match
+	var originIndex int = -1
+	for _, location := range locations {
+		start, end := location[0], location[1]
+
+		// matches come in order, so do origins
+		for originIndex+1 < len(origins) && origins[originIndex+1].Offset <= start {
+			originIndex++
+		}
+
+		match := Match{
+			Text:   string(text[start:end]),
+			Before: collapseWhitespace(charsBefore(text, start, contextChars)),
+			After:  collapseWhitespace(charsAfter(text, end, contextChars)),
+		}
+
+		if originIndex >= 0 {
+			match.Line = origins[originIndex].Line
+			match.Heading = origins[originIndex].Heading
+			match.Element = origins[originIndex].Element
+		}
+
+		matches = append(matches, match)
+	}
+
+	return matches
+}
@@ -0,0 +1,68 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"regexp"
+	"testing"
+)
+
+const contextPage string = `<html><body>
+<h1>Fruit</h1>
+<p>Apples are <b>red</b> or green.</p>
+<h2>Other <i>food</i></h2>
+<div>Bread is
+baked, apples are not</div>
+</body></html>`
+
+// context characters are counted before tags are removed
+func TestMatchContexts(t *testing.T) {
+	re := regexp.MustCompile(`(?i)apples`)
+	matches := MatchContexts([]byte(contextPage), re.FindAllIndex([]byte(contextPage), -1), 12)
+
+	expected := []Match{
+		{Text: "Apples", Before: "uit ", After: " are red", Line: 3, Heading: "Fruit", Element: "p"},
+		{Text: "apples", Before: "d is baked, ", After: " are not", Line: 6, Heading: "Other food", Element: "div"},
+	}
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d matches, got %+v", len(expected), matches)
+	}
+	for index, match := range matches {
+		if match != expected[index] {
+			t.Errorf("match %d: expected %+v, got %+v", index, expected[index], match)
+		}
+	}
+}
+
+func TestCharsAround(t *testing.T) {
+	data := []byte("añb¢c")
+
+	if before := charsBefore(data, len(data), 2); before != "¢c" {
+		t.Errorf("expected 2 characters before the end to be %q, got %q", "¢c", before)
+	}
+	if before := charsBefore(data, 1, 5); before != "a" {
+		t.Errorf("expected characters before offset 1 to be %q, got %q", "a", before)
+	}
+	if after := charsAfter(data, 0, 2); after != "añ" {
+		t.Errorf("expected 2 characters after the start to be %q, got %q", "añ", after)
+	}
+	if after := charsAfter(data, len(data), 3); after != "" {
+		t.Errorf("expected no characters after the end, got %q", after)
+	}
+}
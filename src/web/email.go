@@ -0,0 +1,207 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"errors"
+	"html"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unbewohnte/wecr/config"
+)
+
+// local part, then domain labels and a TLD of letters or an internationalized (xn--) one
+var emailRegexp *regexp.Regexp = regexp.MustCompile(
+	`[A-Za-z0-9._%+\-!&?~^#$'*/=]+@(?:[A-Za-z0-9](?:[A-Za-z0-9\-]{0,61}[A-Za-z0-9])?\.)+(?:xn--[A-Za-z0-9\-]{2,59}|[A-Za-z]{2,63})\b`,
+)
+
+// recipients of mailto: links
+var mailtoRegexp *regexp.Regexp = regexp.MustCompile(`(?i)mailto:([^"'\s<>?]+)`)
+
+// obfuscated @ and . like "name [at] domain (dot) com"
+var obfuscatedAtRegexp *regexp.Regexp = regexp.MustCompile(`(?i)\s*[\[({<]\s*(?:at|@)\s*[\])}>]\s*`)
+var obfuscatedDotRegexp *regexp.Regexp = regexp.MustCompile(`(?i)\s*[\[({<]\s*(?:dot|\.)\s*[\])}>]\s*`)
+
+// File extensions that look like TLDs of addresses such as "logo@2x.png"
+var fileExtensionTLDs = map[string]bool{
+	"png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true, "webp": true, "avif": true,
+	"ico": true, "bmp": true, "css": true, "js": true, "json": true, "html": true, "htm": true,
+}
+
+// Trim punctuation email addresses do not start or end with and lower case the domain. Empty
+// if the result does not look like an address
+func normalizeEmail(email string) string {
+	email = strings.Trim(email, ".-+'")
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return ""
+	}
+
+	domain := strings.ToLower(strings.Trim(email[at+1:], "."))
+	if fileExtensionTLDs[domain[strings.LastIndex(domain, ".")+1:]] {
+		return ""
+	}
+
+	return email[:at] + "@" + domain
+}
+
+// Find email addresses in page: plain ones, HTML entity encoded ones (ie: &#64;), recipients of
+// mailto: links and obfuscated ones like "name [at] domain [dot] com". Addresses are not verified
+func FindPageEmails(pageBody []byte) []string {
+	var emailAddresses []string
+
+	text := html.UnescapeString(string(pageBody))
+
+	var candidates []string
+	for _, match := range mailtoRegexp.FindAllStringSubmatch(text, -1) {
+		recipients, err := url.PathUnescape(match[1])
+		if err != nil {
+			recipients = match[1]
+		}
+		candidates = append(candidates, strings.Split(recipients, ",")...)
+	}
+
+	text = obfuscatedAtRegexp.ReplaceAllString(text, "@")
+	text = obfuscatedDotRegexp.ReplaceAllString(text, ".")
+	candidates = append(candidates, emailRegexp.FindAllString(text, -1)...)
+
+	for _, candidate := range candidates {
+		email := emailRegexp.FindString(strings.TrimSpace(candidate))
+		email = normalizeEmail(email)
+		if email == "" {
+			continue
+		}
+
+		emailAddresses = appendUnique(emailAddresses, email)
+	}
+
+	return emailAddresses
+}
+
+// Whether email address is syntactically valid
+func ValidEmailSyntax(email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 254 {
+		return false
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], email[at+1:]
+	if len(local) > 64 || strings.Contains(local, "..") {
+		return false
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Looks up MX records of domains
+type MXResolver interface {
+	LookupMX(domain string) ([]*net.MX, error)
+}
+
+// Resolver making actual DNS queries
+type netMXResolver struct{}
+
+func (r netMXResolver) LookupMX(domain string) ([]*net.MX, error) {
+	return net.LookupMX(domain)
+}
+
+// Verifies email addresses, remembering which domains have MX records
+type EmailVerifier struct {
+	resolver MXResolver
+	hasMX    map[string]bool
+	lock     sync.Mutex
+}
+
+// Create a new email verifier looking MX records up with resolver, the system one if nil
+func NewEmailVerifier(resolver MXResolver) *EmailVerifier {
+	if resolver == nil {
+		resolver = netMXResolver{}
+	}
+
+	return &EmailVerifier{
+		resolver: resolver,
+		hasMX:    make(map[string]bool),
+	}
+}
+
+// Whether domain has MX records. Definite answers are remembered, so each domain is looked up
+// once; a domain failing to be looked up (ie: because of a timeout) is looked up again next time
+func (v *EmailVerifier) HasMX(domain string) bool {
+	v.lock.Lock()
+	hasMX, ok := v.hasMX[domain]
+	v.lock.Unlock()
+	if ok {
+		return hasMX
+	}
+
+	mx, err := v.resolver.LookupMX(domain)
+	if err != nil {
+		// only the domain or its records not existing is a definite answer
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return false
+		}
+	}
+	hasMX = err == nil && len(mx) != 0
+
+	v.lock.Lock()
+	v.hasMX[domain] = hasMX
+	v.lock.Unlock()
+
+	return hasMX
+}
+
+// Keep email addresses that pass verification of mode (see config.EmailVerificationMX),
+// empty mode is the same as MX lookup
+func (v *EmailVerifier) Verify(emailAddresses []string, mode string) []string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == config.EmailVerificationNone {
+		return emailAddresses
+	}
+
+	var verifiedAddresses []string
+	for _, email := range emailAddresses {
+		if !ValidEmailSyntax(email) {
+			continue
+		}
+
+		if mode != config.EmailVerificationSyntax && !v.HasMX(email[strings.LastIndex(email, "@")+1:]) {
+			continue
+		}
+
+		verifiedAddresses = append(verifiedAddresses, email)
+	}
+
+	return verifiedAddresses
+}
@@ -0,0 +1,143 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"unbewohnte/wecr/config"
+)
+
+func TestFindPageEmails(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   string
+		emails string
+	}{
+		{"plain", "Write to bob@example.com.", "bob@example.com"},
+		{"entity encoded", "bob&#64;example&#46;com", "bob@example.com"},
+		{"mailto", `<a href="mailto:alice@example.org,bob@Example.ORG?subject=hi">mail</a>`, "alice@example.org,bob@example.org"},
+		{"escaped mailto", `<a href="mailto:alice%40example.org">mail</a>`, "alice@example.org"},
+		{"square brackets", "bob [at] example [dot] com", "bob@example.com"},
+		{"parentheses", "bob(at)example(dot)co(dot)uk", "bob@example.co.uk"},
+		{"mixed obfuscation", "bob {@} example <.> com", "bob@example.com"},
+		{"internationalized TLD", "info@example.xn--p1ai", "info@example.xn--p1ai"},
+		{"file names are not addresses", `<img src="logo@2x.png">`, ""},
+		{"duplicates", "bob@example.com bob [at] example [dot] com", "bob@example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			emails := strings.Join(FindPageEmails([]byte(test.page)), ",")
+			if emails != test.emails {
+				t.Errorf("expected %q, got %q", test.emails, emails)
+			}
+		})
+	}
+}
+
+func TestValidEmailSyntax(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"bob@example.com", true},
+		{"bob.smith+tag@mail.example.com", true},
+		{"bob..smith@example.com", false},
+		{"bob@localhost", false},
+		{"bob@-example.com", false},
+		{"bob@example..com", false},
+		{strings.Repeat("a", 65) + "@example.com", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.email, func(t *testing.T) {
+			if ValidEmailSyntax(test.email) != test.valid {
+				t.Errorf("expected valid = %v", test.valid)
+			}
+		})
+	}
+}
+
+// Resolver answering from records by domain, unknown domains do not exist
+type testMXResolver struct {
+	records map[string][]*net.MX
+	// domains failing to be looked up
+	failing map[string]error
+	lookups map[string]int
+}
+
+func (r *testMXResolver) LookupMX(domain string) ([]*net.MX, error) {
+	r.lookups[domain]++
+
+	if err, ok := r.failing[domain]; ok {
+		return nil, err
+	}
+
+	mx, ok := r.records[domain]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+	}
+
+	return mx, nil
+}
+
+func TestEmailVerifier(t *testing.T) {
+	resolver := &testMXResolver{
+		records: map[string][]*net.MX{
+			"example.com": {{Host: "mail.example.com.", Pref: 10}},
+			"nomail.com":  {},
+		},
+		failing: map[string]error{
+			"slow.com": &net.DNSError{Err: "i/o timeout", Name: "slow.com", IsTimeout: true},
+		},
+		lookups: make(map[string]int),
+	}
+	verifier := NewEmailVerifier(resolver)
+
+	emails := []string{"bob@example.com", "bob@missing.com", "bob@nomail.com", "bob@slow.com", "bob..smith@example.com"}
+	tests := []struct {
+		mode     string
+		verified string
+	}{
+		{config.EmailVerificationNone, strings.Join(emails, ",")},
+		{config.EmailVerificationSyntax, "bob@example.com,bob@missing.com,bob@nomail.com,bob@slow.com"},
+		{config.EmailVerificationMX, "bob@example.com"},
+		{"", "bob@example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			verified := strings.Join(verifier.Verify(emails, test.mode), ",")
+			if verified != test.verified {
+				t.Errorf("expected %q, got %q", test.verified, verified)
+			}
+		})
+	}
+
+	// addresses have been checked for MX records twice: definite answers are remembered,
+	// failed lookups are not
+	expectedLookups := map[string]int{"example.com": 1, "missing.com": 1, "nomail.com": 1, "slow.com": 2}
+	for domain, expected := range expectedLookups {
+		if resolver.lookups[domain] != expected {
+			t.Errorf("expected %s to be looked up %d times, got %d", domain, expected, resolver.lookups[domain])
+		}
+	}
+}
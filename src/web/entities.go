@@ -0,0 +1,513 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"unbewohnte/wecr/config"
+)
+
+// Finders of text entities by their queries
+var entityFinders = map[string]func(text []byte) []string{
+	config.QueryPhone:        FindPhoneNumbers,
+	config.QueryIP:           FindIPAddresses,
+	config.QueryURL:          FindTextURLs,
+	config.QueryIBAN:         FindIBANs,
+	config.QueryCreditCard:   FindCreditCards,
+	config.QueryCryptoWallet: FindCryptoWallets,
+	config.QuerySocialHandle: FindSocialHandles,
+}
+
+// Find entities of query (ie: "entity:phone") in text. Ok is false if query is not an entity one
+func FindEntities(query string, text []byte) (entities []string, ok bool) {
+	finder, ok := entityFinders[query]
+	if !ok {
+		return nil, false
+	}
+
+	return finder(text), true
+}
+
+// Append entity to entities unless it is already there
+func appendUnique(entities []string, entity string) []string {
+	for _, existing := range entities {
+		if existing == entity {
+			return entities
+		}
+	}
+
+	return append(entities, entity)
+}
+
+// Whether character at index of text is an ASCII letter or digit. Out of range indices are not
+func isAlphanumericAt(text []byte, index int) bool {
+	if index < 0 || index >= len(text) {
+		return false
+	}
+	char := text[index]
+
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+// Keep only digits of text
+func onlyDigits(text string) string {
+	var digits strings.Builder
+	for _, char := range text {
+		if char >= '0' && char <= '9' {
+			digits.WriteRune(char)
+		}
+	}
+
+	return digits.String()
+}
+
+// international phone numbers: + or 00, then digits separated by spaces, dots, dashes and parentheses
+var phoneRegexp *regexp.Regexp = regexp.MustCompile(`(?:\+|00)[ ]?\(?\d[\d ().\-]{5,22}\d`)
+
+// national trunk prefix written along with the country code, ie: +44 (0) 20
+var trunkPrefixRegexp *regexp.Regexp = regexp.MustCompile(`\(0\)`)
+
+// Find international phone numbers (with + or 00 and the country code) and normalize them to
+// E.164 (+ and up to 15 digits). Numbers without the country code can't be normalized and are skipped
+func FindPhoneNumbers(text []byte) []string {
+	var numbers []string
+
+	for _, location := range phoneRegexp.FindAllIndex(text, -1) {
+		if isAlphanumericAt(text, location[0]-1) || isAlphanumericAt(text, location[1]) {
+			continue
+		}
+		// skip parts of longer digit groups (ie: bank account numbers)
+		var before int = location[0] - 1
+		for before >= 0 && text[before] == ' ' {
+			before--
+		}
+		if before >= 0 && text[before] >= '0' && text[before] <= '9' {
+			continue
+		}
+
+		number := string(text[location[0]:location[1]])
+		number = trunkPrefixRegexp.ReplaceAllString(number, "")
+		if strings.HasPrefix(number, "00") {
+			number = number[2:]
+		}
+
+		digits := onlyDigits(number)
+		if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+			continue
+		}
+
+		numbers = appendUnique(numbers, "+"+digits)
+	}
+
+	return numbers
+}
+
+var ipv4Regexp *regexp.Regexp = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// hex groups with at least two colons, possibly ending with an embedded IPv4 address
+var ipv6Regexp *regexp.Regexp = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}(?::(?:\d{1,3}\.){3}\d{1,3})?`)
+
+// Find IPv4 and IPv6 addresses. IPv6 addresses are written in their canonical form
+func FindIPAddresses(text []byte) []string {
+	var addresses []string
+
+	for _, location := range ipv4Regexp.FindAllIndex(text, -1) {
+		// skip version numbers and the like (1.2.3.4.5)
+		if location[0] > 0 && text[location[0]-1] == '.' ||
+			location[1]+1 < len(text) && text[location[1]] == '.' && isAlphanumericAt(text, location[1]+1) {
+			continue
+		}
+
+		ip := net.ParseIP(string(text[location[0]:location[1]]))
+		if ip == nil {
+			continue
+		}
+		addresses = appendUnique(addresses, ip.String())
+	}
+
+	for _, location := range ipv6Regexp.FindAllIndex(text, -1) {
+		if isAlphanumericAt(text, location[0]-1) || isAlphanumericAt(text, location[1]) {
+			continue
+		}
+
+		candidate := string(text[location[0]:location[1]])
+		ip := net.ParseIP(candidate)
+		if ip == nil || ip.To4() != nil && !strings.Contains(candidate, "::") || candidate == "::" {
+			continue
+		}
+		addresses = appendUnique(addresses, ip.String())
+	}
+
+	return addresses
+}
+
+var textURLRegexp *regexp.Regexp = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"'` + "`" + `]+`)
+
+// Find URLs written in text (with a scheme or starting with www.), without trailing punctuation
+func FindTextURLs(text []byte) []string {
+	var urls []string
+
+	for _, match := range textURLRegexp.FindAll(text, -1) {
+		link := strings.TrimRight(string(match), ".,;:!?'\"")
+		for strings.HasSuffix(link, ")") && strings.Count(link, "(") < strings.Count(link, ")") {
+			link = strings.TrimSuffix(link, ")")
+		}
+		link = strings.TrimRight(link, ".,;:!?")
+
+		if strings.HasPrefix(strings.ToLower(link), "www.") {
+			link = "http://" + link
+		}
+
+		parsedURL, err := url.Parse(link)
+		if err != nil || parsedURL.Host == "" || !strings.Contains(parsedURL.Host, ".") {
+			continue
+		}
+		urls = appendUnique(urls, link)
+	}
+
+	return urls
+}
+
+// IBAN lengths by country codes
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BI": 27,
+	"BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DJ": 27, "DK": 18, "DO": 28,
+	"EE": 20, "EG": 29, "ES": 24, "FI": 18, "FK": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23,
+	"GL": 18, "GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27,
+	"JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "LY": 25,
+	"MC": 27, "MD": 24, "ME": 22, "MK": 19, "MN": 20, "MR": 27, "MT": 31, "MU": 30, "NI": 28, "NL": 18,
+	"NO": 15, "OM": 23, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "RU": 33,
+	"SA": 24, "SC": 31, "SD": 18, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "SO": 23, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20, "YE": 30,
+}
+
+// country code, check digits and the account number, possibly in groups of four
+var ibanRegexp *regexp.Regexp = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+
+// Whether IBAN (without spaces) passes the mod 97 check
+func validIBANChecksum(iban string) bool {
+	rearranged := iban[4:] + iban[:4]
+
+	var remainder int = 0
+	for _, char := range rearranged {
+		var value int
+		switch {
+		case char >= '0' && char <= '9':
+			value = int(char - '0')
+			remainder = (remainder*10 + value) % 97
+		case char >= 'A' && char <= 'Z':
+			value = int(char-'A') + 10
+			remainder = (remainder*100 + value) % 97
+		default:
+			return false
+		}
+	}
+
+	return remainder == 1
+}
+
+// Find IBANs of known countries with the right length and check digits, written without spaces
+func FindIBANs(text []byte) []string {
+	var ibans []string
+
+	for _, match := range ibanRegexp.FindAll(text, -1) {
+		iban := strings.ReplaceAll(string(match), " ", "")
+		length, ok := ibanLengths[iban[:2]]
+		if !ok || len(iban) < length {
+			continue
+		}
+		// the pattern may take in a word following the number
+		iban = iban[:length]
+
+		if validIBANChecksum(iban) {
+			ibans = appendUnique(ibans, iban)
+		}
+	}
+
+	return ibans
+}
+
+// 13 to 19 digits, possibly separated by spaces or dashes
+var cardRegexp *regexp.Regexp = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+
+// Card number prefixes and lengths of major payment networks
+var cardNetworks = []struct {
+	prefixes []string
+	lengths  []int
+}{
+	{[]string{"4"}, []int{13, 16, 19}},
+	{[]string{"51", "52", "53", "54", "55", "22", "23", "24", "25", "26", "27"}, []int{16}},
+	{[]string{"34", "37"}, []int{15}},
+	{[]string{"6011", "644", "645", "646", "647", "648", "649", "65"}, []int{16, 19}},
+	{[]string{"35"}, []int{16, 17, 18, 19}},
+	{[]string{"300", "301", "302", "303", "304", "305", "36", "38"}, []int{14, 16}},
+	{[]string{"62"}, []int{16, 17, 18, 19}},
+}
+
+// Whether number passes the Luhn check
+func validLuhn(number string) bool {
+	var sum int = 0
+	var double bool = false
+	for index := len(number) - 1; index >= 0; index-- {
+		digit := int(number[index] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// Whether number looks like a card of a known payment network
+func knownCardNetwork(number string) bool {
+	for _, network := range cardNetworks {
+		for _, prefix := range network.prefixes {
+			if !strings.HasPrefix(number, prefix) {
+				continue
+			}
+			for _, length := range network.lengths {
+				if len(number) == length {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Find payment card numbers of major networks passing the Luhn check, written without separators
+func FindCreditCards(text []byte) []string {
+	var cards []string
+
+	for _, match := range cardRegexp.FindAll(text, -1) {
+		number := onlyDigits(string(match))
+		if knownCardNetwork(number) && validLuhn(number) {
+			cards = appendUnique(cards, number)
+		}
+	}
+
+	return cards
+}
+
+const base58Alphabet string = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Bitcoin (1, 3), Litecoin (L, M) and Dogecoin (D) base58 addresses
+var base58AddressRegexp *regexp.Regexp = regexp.MustCompile(`\b[13LMD][1-9A-HJ-NP-Za-km-z]{25,34}\b`)
+
+// Bitcoin (bc1) and Litecoin (ltc1) segwit addresses
+var bech32AddressRegexp *regexp.Regexp = regexp.MustCompile(`(?i)\b(?:bc|ltc)1[02-9ac-hj-np-z]{11,71}\b`)
+
+// Ethereum and other EVM chain addresses
+var ethereumAddressRegexp *regexp.Regexp = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+
+// Whether base58 encoded address has a valid double SHA-256 checksum
+func validBase58Check(address string) bool {
+	var value *big.Int = big.NewInt(0)
+	var base *big.Int = big.NewInt(58)
+	for _, char := range address {
+		index := strings.IndexRune(base58Alphabet, char)
+		if index == -1 {
+			return false
+		}
+		value.Mul(value, base)
+		value.Add(value, big.NewInt(int64(index)))
+	}
+
+	decoded := value.Bytes()
+	// leading ones stand for zero bytes
+	for _, char := range address {
+		if char != '1' {
+			break
+		}
+		decoded = append([]byte{0}, decoded...)
+	}
+	if len(decoded) != 25 {
+		return false
+	}
+
+	firstHash := sha256.Sum256(decoded[:21])
+	secondHash := sha256.Sum256(firstHash[:])
+
+	return bytes.Equal(secondHash[:4], decoded[21:])
+}
+
+// Whether bech32 (or bech32m) encoded address has a valid checksum
+func validBech32(address string) bool {
+	const charset string = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	address = strings.ToLower(address)
+	separator := strings.LastIndex(address, "1")
+	if separator < 1 || separator+7 > len(address) {
+		return false
+	}
+
+	var values []int
+	hrp := address[:separator]
+	for _, char := range hrp {
+		values = append(values, int(char>>5))
+	}
+	values = append(values, 0)
+	for _, char := range hrp {
+		values = append(values, int(char&31))
+	}
+	for _, char := range address[separator+1:] {
+		index := strings.IndexRune(charset, char)
+		if index == -1 {
+			return false
+		}
+		values = append(values, index)
+	}
+
+	var generator = [5]int{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	var checksum int = 1
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ value
+		for index := 0; index < 5; index++ {
+			if (top>>index)&1 == 1 {
+				checksum ^= generator[index]
+			}
+		}
+	}
+
+	// bech32 or bech32m constant
+	return checksum == 1 || checksum == 0x2bc830a3
+}
+
+// Find Bitcoin, Litecoin, Dogecoin (with valid checksums) and Ethereum wallet addresses
+func FindCryptoWallets(text []byte) []string {
+	var wallets []string
+
+	for _, match := range base58AddressRegexp.FindAll(text, -1) {
+		if validBase58Check(string(match)) {
+			wallets = appendUnique(wallets, string(match))
+		}
+	}
+
+	for _, match := range bech32AddressRegexp.FindAll(text, -1) {
+		if validBech32(string(match)) {
+			wallets = appendUnique(wallets, strings.ToLower(string(match)))
+		}
+	}
+
+	for _, match := range ethereumAddressRegexp.FindAll(text, -1) {
+		wallets = appendUnique(wallets, string(match))
+	}
+
+	return wallets
+}
+
+// bare @handle mentions
+var mentionRegexp *regexp.Regexp = regexp.MustCompile(`@[A-Za-z0-9_]{2,30}`)
+
+// profile links of popular social networks
+var profileRegexp *regexp.Regexp = regexp.MustCompile(
+	`(?i)\b(?:https?://)?(?:www\.|m\.|mobile\.)?(twitter\.com|x\.com|instagram\.com|facebook\.com|github\.com|tiktok\.com|youtube\.com|t\.me|linkedin\.com/in|reddit\.com/user|reddit\.com/u)/(@?[A-Za-z0-9_][A-Za-z0-9_.\-]*)`,
+)
+
+// Social networks by their profile link hosts
+var socialNetworks = map[string]string{
+	"twitter.com":     "twitter",
+	"x.com":           "twitter",
+	"instagram.com":   "instagram",
+	"facebook.com":    "facebook",
+	"github.com":      "github",
+	"tiktok.com":      "tiktok",
+	"youtube.com":     "youtube",
+	"t.me":            "telegram",
+	"linkedin.com/in": "linkedin",
+	"reddit.com/user": "reddit",
+	"reddit.com/u":    "reddit",
+}
+
+// Paths of social network sites that are not profiles
+var nonProfilePaths = map[string]bool{
+	"share": true, "sharer": true, "sharer.php": true, "intent": true, "home": true, "login": true,
+	"signup": true, "search": true, "hashtag": true, "explore": true, "watch": true, "channel": true,
+	"c": true, "p": true, "reel": true, "reels": true, "about": true, "settings": true, "i": true,
+	"privacy": true, "tos": true, "help": true, "policies": true, "pages": true, "groups": true,
+	"events": true, "marketplace": true, "results": true, "embed": true, "feed": true, "shorts": true,
+	"playlist": true, "trending": true, "orgs": true, "topics": true, "sponsors": true, "features": true,
+	"notifications": true, "messages": true, "join": true, "s": true, "tags": true, "tr": true,
+	"plugins": true, "dialog": true, "legal": true, "terms": true, "dialogs": true, "profile.php": true,
+}
+
+// CSS at-rules and the like that look just as mentions
+var nonHandles = map[string]bool{
+	"media": true, "import": true, "font": true, "keyframes": true, "charset": true, "supports": true,
+	"page": true, "namespace": true, "layer": true, "container": true, "property": true, "apply": true,
+	"tailwind": true, "param": true, "return": true, "returns": true, "type": true, "see": true,
+}
+
+// Find social media handles: bare @mentions as "@handle" and profile links as "network:handle"
+func FindSocialHandles(text []byte) []string {
+	var handles []string
+
+	for _, match := range profileRegexp.FindAllSubmatch(text, -1) {
+		network := socialNetworks[strings.ToLower(string(match[1]))]
+		handle := strings.TrimRight(string(match[2]), ".-")
+
+		// youtube and tiktok handles are the ones with @, the rest are videos and channels
+		if network == "youtube" || network == "tiktok" {
+			if !strings.HasPrefix(handle, "@") {
+				continue
+			}
+		}
+		handle = strings.TrimPrefix(handle, "@")
+		if handle == "" || nonProfilePaths[strings.ToLower(handle)] {
+			continue
+		}
+
+		handles = appendUnique(handles, network+":"+handle)
+	}
+
+	for _, location := range mentionRegexp.FindAllIndex(text, -1) {
+		// skip email addresses and domains
+		if location[0] > 0 {
+			before := text[location[0]-1]
+			if isAlphanumericAt(text, location[0]-1) || before == '.' || before == '_' || before == '@' || before == '/' {
+				continue
+			}
+		}
+		if location[1] < len(text) && (text[location[1]] == '@' ||
+			text[location[1]] == '.' && isAlphanumericAt(text, location[1]+1)) {
+			continue
+		}
+
+		handle := string(text[location[0]+1 : location[1]])
+		if nonHandles[strings.ToLower(handle)] {
+			continue
+		}
+		handles = appendUnique(handles, "@"+handle)
+	}
+
+	return handles
+}
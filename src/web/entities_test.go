@@ -0,0 +1,112 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	tests := []struct {
+		valid func(entity string) bool
+		// entities with their checksums valid, then the ones with invalid checksums
+		good []string
+		bad  []string
+	}{
+		{
+			validIBANChecksum,
+			[]string{"GB82WEST12345698765432", "DE89370400440532013000", "FR1420041010050500013M02606"},
+			[]string{"GB82WEST12345698765433", "GB28WEST12345698765432", "DE89370400440532013000-"},
+		},
+		{
+			validLuhn,
+			[]string{"4111111111111111", "5555555555554444", "378282246310005", "79927398713"},
+			[]string{"4111111111111112", "79927398710"},
+		},
+		{
+			validBase58Check,
+			[]string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"},
+			// 0 is not in the alphabet
+			[]string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLY", "1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf0a", "1A1zP1eP5QGefi2DMPTfTL"},
+		},
+		{
+			validBech32,
+			// bech32 in both cases and bech32m
+			[]string{
+				"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+				"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+			},
+			[]string{
+				"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3tb",
+				"bc1qw5", "qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		for _, entity := range test.good {
+			if !test.valid(entity) {
+				t.Errorf("expected %s to be valid", entity)
+			}
+		}
+		for _, entity := range test.bad {
+			if test.valid(entity) {
+				t.Errorf("expected %s to be invalid", entity)
+			}
+		}
+	}
+}
+
+func TestFindEntities(t *testing.T) {
+	tests := []struct {
+		name     string
+		find     func(text []byte) []string
+		text     string
+		entities string
+	}{
+		{
+			"IBANs in groups",
+			FindIBANs,
+			"Pay to GB82 WEST 1234 5698 7654 32 or GB82 WEST 1234 5698 7654 33 today",
+			"GB82WEST12345698765432",
+		},
+		{
+			"cards of known networks",
+			FindCreditCards,
+			"4111-1111-1111-1111, 4111 1111 1111 1112 and 1234567812345670",
+			"4111111111111111",
+		},
+		{
+			"wallets",
+			FindCryptoWallets,
+			"to 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa, BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4 or 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb",
+			"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa,bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entities := strings.Join(test.find([]byte(test.text)), ",")
+			if entities != test.entities {
+				t.Errorf("expected %q, got %q", test.entities, entities)
+			}
+		})
+	}
+}
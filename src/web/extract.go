@@ -0,0 +1,171 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"strings"
+	"unbewohnte/wecr/config"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Structured record extracted from a page: field values by field names. A value is
+// a string or, for fields taking all matching elements, a list of strings
+type Record map[string]interface{}
+
+// Collapsed text content of node, without invisible elements
+func nodeText(node *html.Node) string {
+	var text strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.TextNode:
+			text.WriteString(node.Data)
+			text.WriteByte(' ')
+			return
+		case html.ElementNode:
+			if invisibleElements[node.Data] {
+				return
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+// Value of node that field targets: its attribute or its text
+func fieldValue(node *html.Node, field config.ExtractField) string {
+	if field.Attribute == "" {
+		return nodeText(node)
+	}
+
+	for _, attribute := range node.Attr {
+		if strings.EqualFold(attribute.Key, field.Attribute) {
+			return strings.TrimSpace(attribute.Val)
+		}
+	}
+
+	return ""
+}
+
+// Extraction settings with selectors compiled beforehand
+type Extractor struct {
+	extract config.Extract
+	// nil if records are taken from the whole page
+	container cascadia.Selector
+	// selectors of fields by their index, nil for fields taking the container itself
+	fields []cascadia.Selector
+}
+
+// Compile selectors of extraction settings
+func NewExtractor(extract config.Extract) (*Extractor, error) {
+	var extractor Extractor = Extractor{
+		extract: extract,
+		fields:  make([]cascadia.Selector, len(extract.Fields)),
+	}
+
+	if extract.Container != "" {
+		containerSelector, err := cascadia.Compile(extract.Container)
+		if err != nil {
+			return nil, err
+		}
+		extractor.container = containerSelector
+	}
+
+	for index, field := range extract.Fields {
+		if field.Selector == "" {
+			continue
+		}
+
+		fieldSelector, err := cascadia.Compile(field.Selector)
+		if err != nil {
+			return nil, err
+		}
+		extractor.fields[index] = fieldSelector
+	}
+
+	return &extractor, nil
+}
+
+// Extract records from page: one per container element or a single one for the whole page if
+// container is not set. Records with all fields empty are not returned
+func (e *Extractor) Records(pageBody []byte) ([]Record, error) {
+	document, err := html.Parse(bytes.NewReader(pageBody))
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []*html.Node = []*html.Node{document}
+	if e.container != nil {
+		containers = e.container.MatchAll(document)
+	}
+
+	var records []Record
+	for _, container := range containers {
+		var record Record = make(Record)
+		var empty bool = true
+
+		for index, field := range e.extract.Fields {
+			var nodes []*html.Node = []*html.Node{container}
+			if e.fields[index] != nil {
+				nodes = e.fields[index].MatchAll(container)
+			}
+
+			if field.All {
+				var values []string = []string{}
+				for _, node := range nodes {
+					value := fieldValue(node, field)
+					if value != "" {
+						values = append(values, value)
+					}
+				}
+				record[field.Name] = values
+				if len(values) != 0 {
+					empty = false
+				}
+				continue
+			}
+
+			var value string = ""
+			for _, node := range nodes {
+				value = fieldValue(node, field)
+				if value != "" {
+					break
+				}
+			}
+			record[field.Name] = value
+			if value != "" {
+				empty = false
+			}
+		}
+
+		if !empty {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,107 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"encoding/json"
+	"testing"
+	"unbewohnte/wecr/config"
+)
+
+const extractPage string = `<html><head><title>Shop</title></head><body>
+<h1>Products</h1>
+<div class="product"><a href="/a">Apple</a><span class="price"> 1.50 </span><span class="tag">fruit</span><span class="tag">red</span></div>
+<div class="product"><a href="/b">Bread</a><span class="price">2<script>var discount = 1;</script></span></div>
+<div class="product"><span class="note">sold out</span></div>
+</body></html>`
+
+func TestExtractorRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		extract config.Extract
+		records string
+	}{
+		{
+			"whole page",
+			config.Extract{Fields: []config.ExtractField{{Name: "heading", Selector: "h1"}}},
+			`[{"heading":"Products"}]`,
+		},
+		{
+			"containers with attributes and lists",
+			config.Extract{
+				Container: "div.product",
+				Fields: []config.ExtractField{
+					{Name: "name", Selector: "a"},
+					{Name: "link", Selector: "a", Attribute: "HREF"},
+					{Name: "price", Selector: ".price"},
+					{Name: "tags", Selector: ".tag", All: true},
+				},
+			},
+			`[{"link":"/a","name":"Apple","price":"1.50","tags":["fruit","red"]},{"link":"/b","name":"Bread","price":"2","tags":[]}]`,
+		},
+		{
+			"container itself",
+			config.Extract{Container: "a", Fields: []config.ExtractField{{Name: "name"}}},
+			`[{"name":"Apple"},{"name":"Bread"}]`,
+		},
+		{
+			"text of invisible elements is left out",
+			config.Extract{Container: "div.product", Fields: []config.ExtractField{{Name: "price", Selector: ".price"}}},
+			`[{"price":"1.50"},{"price":"2"}]`,
+		},
+		{
+			"no record with every field empty",
+			config.Extract{Fields: []config.ExtractField{{Name: "missing", Selector: "table"}}},
+			`null`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			extractor, err := NewExtractor(test.extract)
+			if err != nil {
+				t.Fatalf("failed to compile: %s", err)
+			}
+
+			records, err := extractor.Records([]byte(extractPage))
+			if err != nil {
+				t.Fatalf("failed to extract: %s", err)
+			}
+
+			encoded, _ := json.Marshal(records)
+			if string(encoded) != test.records {
+				t.Errorf("expected %s, got %s", test.records, encoded)
+			}
+		})
+	}
+}
+
+func TestNewExtractorInvalid(t *testing.T) {
+	tests := []config.Extract{
+		{Container: "div[", Fields: []config.ExtractField{{Name: "a", Selector: "a"}}},
+		{Fields: []config.ExtractField{{Name: "a", Selector: "a"}, {Name: "b", Selector: ">>"}}},
+	}
+
+	for _, test := range tests {
+		_, err := NewExtractor(test)
+		if err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
@@ -25,4 +25,10 @@ type Job struct {
 	URL    string        `json:"u"`
 	Search config.Search `json:"s"`
 	Depth  uint          `json:"d"`
+	// Name of the crawl job this visit belongs to, empty for the only one
+	Name string `json:"n,omitempty"`
+	// Initial page this visit originated from
+	Seed string `json:"o,omitempty"`
+	// Number of links in a row that led off site to this page, 0 for pages on site
+	Hops uint `json:"h,omitempty"`
 }
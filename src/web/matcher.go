@@ -0,0 +1,116 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Finds plain text on pages
+type TextMatcher struct {
+	CaseSensitive bool
+	// Whether text must not be a part of a longer word
+	WholeWord bool
+	// Compiled expressions of known terms
+	terms map[string]*regexp.Regexp
+}
+
+// Create a matcher with terms compiled beforehand, so looking for them does not compile them again
+func NewTextMatcher(terms []string, caseSensitive bool, wholeWord bool) *TextMatcher {
+	matcher := &TextMatcher{
+		CaseSensitive: caseSensitive,
+		WholeWord:     wholeWord,
+		terms:         make(map[string]*regexp.Regexp, len(terms)),
+	}
+
+	for _, term := range terms {
+		matcher.terms[term] = matcher.compile(term)
+	}
+
+	return matcher
+}
+
+// Compile expression finding text
+func (m TextMatcher) compile(text string) *regexp.Regexp {
+	var expression string = regexp.QuoteMeta(text)
+	if !m.CaseSensitive {
+		expression = "(?i)" + expression
+	}
+
+	return regexp.MustCompile(expression)
+}
+
+// Check whether r can be a part of a word
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Check whether data[start:end] is not surrounded by word characters
+func isWholeWord(data []byte, start int, end int) bool {
+	if start > 0 {
+		before, _ := utf8.DecodeLastRune(data[:start])
+		first, _ := utf8.DecodeRune(data[start:end])
+		if isWordRune(before) && isWordRune(first) {
+			return false
+		}
+	}
+
+	if end < len(data) {
+		after, _ := utf8.DecodeRune(data[end:])
+		last, _ := utf8.DecodeLastRune(data[start:end])
+		if isWordRune(after) && isWordRune(last) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Find locations of up to limit occurrences of text in data; limit < 0 finds all of them.
+// Every location is a pair of start and end offsets like the ones of regexp.FindAllIndex
+func (m TextMatcher) FindAll(data []byte, text string, limit int) [][]int {
+	re, ok := m.terms[text]
+	if !ok {
+		re = m.compile(text)
+	}
+
+	if !m.WholeWord {
+		return re.FindAllIndex(data, limit)
+	}
+
+	var locations [][]int
+	for _, location := range re.FindAllIndex(data, -1) {
+		if limit >= 0 && len(locations) >= limit {
+			break
+		}
+
+		if isWholeWord(data, location[0], location[1]) {
+			locations = append(locations, location)
+		}
+	}
+
+	return locations
+}
+
+// Check whether text is in data
+func (m TextMatcher) Contains(data []byte, text string) bool {
+	return len(m.FindAll(data, text, 1)) != 0
+}
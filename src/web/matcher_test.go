@@ -0,0 +1,63 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import "testing"
+
+func TestTextMatcherFindAll(t *testing.T) {
+	tests := []struct {
+		name          string
+		caseSensitive bool
+		wholeWord     bool
+		data          string
+		text          string
+		found         int
+	}{
+		{"case insensitive", false, false, "Wecr and WECR", "wecr", 2},
+		{"case sensitive", true, false, "Wecr and WECR", "WECR", 1},
+		{"substring", false, false, "crawler crawl", "crawl", 2},
+		{"whole word", false, true, "crawler crawl", "crawl", 1},
+		{"whole word at edges", false, true, "crawl, (crawl)", "crawl", 2},
+		{"whole word with underscore", false, true, "_crawl crawl_", "crawl", 0},
+		{"whole word in unicode text", false, true, "жук жуки", "жук", 1},
+		{"whole word phrase", false, true, "web scrapers, web scraper.", "web scraper", 1},
+		{"whole word of punctuation", false, true, "c++ and c++11", "c++", 2},
+		{"special characters", false, false, "1+1=2", "1+1", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matchers := []*TextMatcher{
+				{CaseSensitive: test.caseSensitive, WholeWord: test.wholeWord},
+				NewTextMatcher([]string{test.text}, test.caseSensitive, test.wholeWord),
+			}
+
+			for _, matcher := range matchers {
+				locations := matcher.FindAll([]byte(test.data), test.text, -1)
+				if len(locations) != test.found {
+					t.Errorf("expected %d occurrences, got %v", test.found, locations)
+				}
+
+				if matcher.Contains([]byte(test.data), test.text) != (test.found != 0) {
+					t.Errorf("Contains disagrees with FindAll")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Structured metadata embedded in a page
+type Metadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Language    string `json:"language,omitempty"`
+	// Contents of every application/ld+json script
+	JSONLD []interface{} `json:"json_ld,omitempty"`
+	// OpenGraph (og:, article:, etc.) meta properties, repeated ones in order
+	OpenGraph map[string][]string `json:"open_graph,omitempty"`
+	// Twitter card meta tags
+	Twitter map[string]string `json:"twitter,omitempty"`
+	// Top level microdata items
+	Microdata []MicrodataItem `json:"microdata,omitempty"`
+}
+
+// Microdata item (an element with itemscope)
+type MicrodataItem struct {
+	Type []string `json:"type,omitempty"`
+	ID   string   `json:"id,omitempty"`
+	// Values of item properties by their names. A value is a string or a nested MicrodataItem
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+// Whether nothing has been found
+func (m Metadata) IsEmpty() bool {
+	return m.Title == "" && m.Description == "" && m.Language == "" &&
+		len(m.JSONLD) == 0 && len(m.OpenGraph) == 0 && len(m.Twitter) == 0 && len(m.Microdata) == 0
+}
+
+// Value of node attribute, empty if there is none
+func attribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
+
+// Whether node has an attribute
+func hasAttribute(node *html.Node, key string) bool {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Raw text content of node
+func rawText(node *html.Node) string {
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			text.WriteString(child.Data)
+		}
+	}
+
+	return text.String()
+}
+
+// Decode JSON-LD script, skipping HTML comment and CDATA wrappers some sites put around it
+func decodeJSONLD(script string) (interface{}, bool) {
+	script = strings.TrimSpace(script)
+	for _, wrapper := range [][2]string{{"<!--", "-->"}, {"<![CDATA[", "]]>"}, {"//<![CDATA[", "//]]>"}} {
+		if strings.HasPrefix(script, wrapper[0]) && strings.HasSuffix(script, wrapper[1]) {
+			script = strings.TrimSpace(script[len(wrapper[0]) : len(script)-len(wrapper[1])])
+		}
+	}
+
+	var document interface{}
+	err := json.Unmarshal([]byte(script), &document)
+	if err != nil {
+		return nil, false
+	}
+
+	return document, true
+}
+
+// Value of microdata property element according to its kind
+func microdataValue(node *html.Node) string {
+	switch node.Data {
+	case "meta":
+		return attribute(node, "content")
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return attribute(node, "src")
+	case "a", "area", "link":
+		return attribute(node, "href")
+	case "object":
+		return attribute(node, "data")
+	case "data", "meter":
+		return attribute(node, "value")
+	case "time":
+		if hasAttribute(node, "datetime") {
+			return attribute(node, "datetime")
+		}
+	}
+
+	return nodeText(node)
+}
+
+// Read microdata item of itemscope element
+func readMicrodataItem(node *html.Node) MicrodataItem {
+	var item MicrodataItem = MicrodataItem{
+		Type:       strings.Fields(attribute(node, "itemtype")),
+		ID:         attribute(node, "itemid"),
+		Properties: make(map[string][]interface{}),
+	}
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+
+			names := strings.Fields(attribute(child, "itemprop"))
+			isScope := hasAttribute(child, "itemscope")
+
+			if len(names) != 0 {
+				var value interface{}
+				if isScope {
+					value = readMicrodataItem(child)
+				} else {
+					value = microdataValue(child)
+				}
+				for _, name := range names {
+					item.Properties[name] = append(item.Properties[name], value)
+				}
+			}
+
+			// properties of nested items belong to them
+			if !isScope {
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+
+	return item
+}
+
+// Find title, description, language, JSON-LD, OpenGraph and Twitter meta tags and microdata of page
+func FindPageMetadata(pageBody []byte) (Metadata, error) {
+	var metadata Metadata = Metadata{}
+
+	document, err := html.Parse(bytes.NewReader(pageBody))
+	if err != nil {
+		return metadata, err
+	}
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "html":
+				metadata.Language = strings.TrimSpace(attribute(node, "lang"))
+
+			case "title":
+				if metadata.Title == "" {
+					metadata.Title = strings.Join(strings.Fields(rawText(node)), " ")
+				}
+
+			case "script":
+				if strings.EqualFold(strings.TrimSpace(attribute(node, "type")), "application/ld+json") {
+					if document, ok := decodeJSONLD(rawText(node)); ok {
+						metadata.JSONLD = append(metadata.JSONLD, document)
+					}
+				}
+				return
+
+			case "meta":
+				property := strings.ToLower(strings.TrimSpace(attribute(node, "property")))
+				name := strings.ToLower(strings.TrimSpace(attribute(node, "name")))
+				content := strings.TrimSpace(attribute(node, "content"))
+
+				switch {
+				case name == "description" && metadata.Description == "":
+					metadata.Description = content
+
+				case strings.HasPrefix(name, "twitter:") || strings.HasPrefix(property, "twitter:"):
+					key := name
+					if key == "" {
+						key = property
+					}
+					if metadata.Twitter == nil {
+						metadata.Twitter = make(map[string]string)
+					}
+					if _, ok := metadata.Twitter[key]; !ok {
+						metadata.Twitter[key] = content
+					}
+
+				case strings.Contains(property, ":"):
+					if metadata.OpenGraph == nil {
+						metadata.OpenGraph = make(map[string][]string)
+					}
+					metadata.OpenGraph[property] = append(metadata.OpenGraph[property], content)
+				}
+			}
+
+			if hasAttribute(node, "itemscope") && !hasAttribute(node, "itemprop") {
+				metadata.Microdata = append(metadata.Microdata, readMicrodataItem(node))
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(document)
+
+	return metadata, nil
+}
@@ -0,0 +1,88 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFindPageMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		metadata string
+	}{
+		{"nothing", `<html><body><p>text</p></body></html>`, `{}`},
+		{
+			"head",
+			`<html lang=" en "><head><title> Fruit
+				shop </title><title>second</title>
+			<meta name="Description" content=" Fresh fruit ">
+			<meta property="og:image" content="/a.png"><meta property="og:image" content="/b.png">
+			<meta property="article:author" content="Bob">
+			<meta name="twitter:card" content="summary"><meta property="twitter:site" content="@shop">
+			<meta name="twitter:card" content="large">
+			</head></html>`,
+			`{"title":"Fruit shop","description":"Fresh fruit","language":"en",` +
+				`"open_graph":{"article:author":["Bob"],"og:image":["/a.png","/b.png"]},` +
+				`"twitter":{"twitter:card":"summary","twitter:site":"@shop"}}`,
+		},
+		{
+			"JSON-LD",
+			`<script type="application/ld+json">{"@type": "Product", "name": "Apple"}</script>
+			<script type="Application/LD+JSON"><!-- [1, 2] --></script>
+			<script type="application/ld+json">{broken</script>
+			<script>{"@type": "Ignored"}</script>`,
+			`{"json_ld":[{"@type":"Product","name":"Apple"},[1,2]]}`,
+		},
+		{
+			"microdata",
+			`<div itemscope itemtype="https://schema.org/Product" itemid="urn:1">
+				<span itemprop="name">Apple</span>
+				<a itemprop="url" href="/apple">link</a>
+				<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+					<meta itemprop="price" content="1.50"><time itemprop="validFrom" datetime="2023-01-01">today</time>
+				</div>
+				<img itemprop="image photo" src="/apple.png">
+			</div>`,
+			`{"microdata":[{"type":["https://schema.org/Product"],"id":"urn:1","properties":{` +
+				`"image":["/apple.png"],"name":["Apple"],` +
+				`"offers":[{"type":["https://schema.org/Offer"],"properties":{"price":["1.50"],"validFrom":["2023-01-01"]}}],` +
+				`"photo":["/apple.png"],"url":["/apple"]}}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadata, err := FindPageMetadata([]byte(test.page))
+			if err != nil {
+				t.Fatalf("failed to find metadata: %s", err)
+			}
+
+			jsonData, _ := json.Marshal(metadata)
+			if string(jsonData) != test.metadata {
+				t.Errorf("expected %s, got %s", test.metadata, jsonData)
+			}
+			if metadata.IsEmpty() != (test.metadata == `{}`) {
+				t.Errorf("expected IsEmpty to be %v", test.metadata == `{}`)
+			}
+		})
+	}
+}
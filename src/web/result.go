@@ -24,5 +24,13 @@ import "unbewohnte/wecr/config"
 type Result struct {
 	PageURL string
 	Search  config.Search
-	Data    []string
+	// Name of the search rule that found data, empty for the search query
+	Rule string `json:",omitempty"`
+	Data []string
+	// Where every match has been found, if context is captured
+	Matches []Match `json:",omitempty"`
+	// Records extracted from the page, if extracting
+	Records []Record `json:",omitempty"`
+	// Metadata of the page, if extracting it
+	Metadata *Metadata `json:",omitempty"`
 }
@@ -0,0 +1,181 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Read newline-delimited URLs. Empty lines and lines starting with "#" are skipped
+func ReadURLList(r io.Reader) ([]string, error) {
+	var urls []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+
+	return urls, scanner.Err()
+}
+
+// Decompress data if it is gzipped, return it as is otherwise
+func gunzipped(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return data, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// Parse sitemap or sitemap index, gzipped or not. Returns page URLs of a sitemap
+// and sitemap URLs of an index
+func ParseSitemap(data []byte) (pages []string, sitemaps []string, err error) {
+	data, err = gunzipped(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var document sitemapDocument
+	err = xml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, page := range document.URLs {
+		if page = strings.TrimSpace(page); page != "" {
+			pages = append(pages, page)
+		}
+	}
+
+	for _, sitemap := range document.Sitemaps {
+		if sitemap = strings.TrimSpace(sitemap); sitemap != "" {
+			sitemaps = append(sitemaps, sitemap)
+		}
+	}
+
+	return pages, sitemaps, nil
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type feedDocument struct {
+	XMLName xml.Name
+	// RSS 2.0
+	Items []struct {
+		Link string `xml:"link"`
+	} `xml:"channel>item"`
+	// RSS 1.0 (RDF), where items follow the channel
+	RDFItems []struct {
+		Link string `xml:"link"`
+	} `xml:"item"`
+	// Atom
+	Entries []struct {
+		Links []atomLink `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse RSS (1.0 or 2.0) or Atom feed, gzipped or not, and return links of its items resolved against feedURL
+func ParseFeed(data []byte, feedURL url.URL) ([]string, error) {
+	data, err := gunzipped(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var document feedDocument
+	err = xml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	for _, item := range document.Items {
+		links = append(links, item.Link)
+	}
+	for _, item := range document.RDFItems {
+		links = append(links, item.Link)
+	}
+
+	for _, entry := range document.Entries {
+		for _, link := range entry.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				links = append(links, link.Href)
+				break
+			}
+		}
+	}
+
+	var resolved []string
+	for _, link := range links {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+
+		linkURL, err := feedURL.Parse(link)
+		if err != nil {
+			continue
+		}
+		resolved = append(resolved, linkURL.String())
+	}
+
+	return resolved, nil
+}
+
+// Find sitemap URLs announced in robots.txt
+func FindRobotsSitemaps(robotsTxt []byte) []string {
+	var sitemaps []string
+
+	for _, line := range strings.Split(string(robotsTxt), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			continue
+		}
+
+		if value = strings.TrimSpace(value); value != "" {
+			sitemaps = append(sitemaps, value)
+		}
+	}
+
+	return sitemaps
+}
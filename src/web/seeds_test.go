@@ -0,0 +1,147 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Compress data with gzip
+func gzipped(t *testing.T, data string) string {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(data))
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatalf("failed to compress: %s", err)
+	}
+
+	return compressed.String()
+}
+
+func TestReadURLList(t *testing.T) {
+	urls, err := ReadURLList(strings.NewReader("https://a.org/\n\n# comment\n  https://b.org/  \r\n"))
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if strings.Join(urls, ",") != "https://a.org/,https://b.org/" {
+		t.Errorf("unexpected URLs: %v", urls)
+	}
+}
+
+func TestParseSitemap(t *testing.T) {
+	const sitemap string = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc> https://a.org/1 </loc><lastmod>2023-01-01</lastmod></url>
+	<url><loc></loc></url>
+	<url><loc>https://a.org/2</loc></url>
+</urlset>`
+	const index string = `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://a.org/sitemap1.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+	tests := []struct {
+		name     string
+		data     string
+		pages    string
+		sitemaps string
+	}{
+		{"sitemap", sitemap, "https://a.org/1,https://a.org/2", ""},
+		{"gzipped sitemap", gzipped(t, sitemap), "https://a.org/1,https://a.org/2", ""},
+		{"index", index, "", "https://a.org/sitemap1.xml.gz"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pages, sitemaps, err := ParseSitemap([]byte(test.data))
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if strings.Join(pages, ",") != test.pages || strings.Join(sitemaps, ",") != test.sitemaps {
+				t.Errorf("expected pages %q and sitemaps %q, got %v and %v", test.pages, test.sitemaps, pages, sitemaps)
+			}
+		})
+	}
+
+	if _, _, err := ParseSitemap([]byte("<urlset><url>")); err == nil {
+		t.Errorf("expected an error for a broken sitemap")
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	const rss2 string = `<rss version="2.0"><channel><title>a</title><link>https://a.org/</link>
+	<item><title>one</title><link>https://a.org/1</link></item>
+	<item><title>two</title><link>/2</link></item>
+</channel></rss>`
+
+	tests := []struct {
+		name  string
+		data  string
+		links string
+	}{
+		{"RSS 2.0", rss2, "https://a.org/1,https://a.org/2"},
+		{"gzipped RSS 2.0", gzipped(t, rss2), "https://a.org/1,https://a.org/2"},
+		{
+			"RSS 1.0",
+			`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+	<channel rdf:about="https://a.org/"><title>a</title><link>https://a.org/</link></channel>
+	<item rdf:about="https://a.org/1"><title>one</title><link>https://a.org/1</link></item>
+	<item rdf:about="https://a.org/2"><title>two</title><link> 2 </link></item>
+</rdf:RDF>`,
+			"https://a.org/1,https://a.org/feeds/2",
+		},
+		{
+			"Atom",
+			`<feed xmlns="http://www.w3.org/2005/Atom"><link href="https://a.org/"/>
+	<entry><link rel="edit" href="/edit/1"/><link rel="alternate" href="https://a.org/1"/></entry>
+	<entry><link href="/2"/></entry>
+	<entry><link rel="enclosure" href="/3.mp3"/></entry>
+</feed>`,
+			"https://a.org/1,https://a.org/2",
+		},
+	}
+
+	feedURL, _ := url.Parse("https://a.org/feeds/rss.xml")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			links, err := ParseFeed([]byte(test.data), *feedURL)
+			if err != nil {
+				t.Fatalf("failed to parse: %s", err)
+			}
+			if strings.Join(links, ",") != test.links {
+				t.Errorf("expected links %q, got %v", test.links, links)
+			}
+		})
+	}
+}
+
+func TestFindRobotsSitemaps(t *testing.T) {
+	robotsTxt := "User-agent: *\nDisallow: /private\nSitemap: https://a.org/sitemap.xml\r\n  sitemap:https://a.org/news.xml\nSitemap:\n"
+
+	sitemaps := FindRobotsSitemaps([]byte(robotsTxt))
+	if strings.Join(sitemaps, ",") != "https://a.org/sitemap.xml,https://a.org/news.xml" {
+		t.Errorf("unexpected sitemaps: %v", sitemaps)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"hash/fnv"
+	"math/bits"
+	"unicode"
+)
+
+// Words in a row that make up a single feature of the text
+const simHashShingleWords int = 3
+
+// Split text into lower case words
+func Words(text []byte) []string {
+	var words []string
+	for _, word := range bytes.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words = append(words, string(bytes.ToLower(word)))
+	}
+
+	return words
+}
+
+// Compute a 64 bit SimHash fingerprint of words: similar texts get fingerprints differing in few bits
+func SimHash(words []string) uint64 {
+	var weights [64]int
+
+	addFeature := func(feature string) {
+		hash := fnv.New64a()
+		hash.Write([]byte(feature))
+		sum := hash.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	if len(words) < simHashShingleWords {
+		for _, word := range words {
+			addFeature(word)
+		}
+	}
+	for index := 0; index+simHashShingleWords <= len(words); index++ {
+		var shingle string = words[index]
+		for _, word := range words[index+1 : index+simHashShingleWords] {
+			shingle += " " + word
+		}
+		addFeature(shingle)
+	}
+
+	var fingerprint uint64 = 0
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+
+	return fingerprint
+}
+
+// Number of bits two fingerprints differ in
+func HammingDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
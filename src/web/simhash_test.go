@@ -0,0 +1,140 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const simHashArticle string = `Wecr is a simple web crawler that searches pages for text, emails, images,
+videos, audio and documents. It starts from the initial pages and follows links up to the configured
+depth, saving whatever it finds to the output directory. Every job may have its own scope rules, search
+rules and budget, while the web dashboard shows what the workers are doing and lets the crawl be paused
+and resumed. Pages that look almost the same as the ones already seen are skipped.`
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		text  string
+		words string
+	}{
+		{"", ""},
+		{"Hello, World!", "hello,world"},
+		{"  wecr-v0.3 (2023)  ", "wecr,v0,3,2023"},
+		{"Привет, мир", "привет,мир"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			words := strings.Join(Words([]byte(test.text)), ",")
+			if words != test.words {
+				t.Errorf("expected %q, got %q", test.words, words)
+			}
+		})
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a        uint64
+		b        uint64
+		distance int
+	}{
+		{0, 0, 0},
+		{0xff, 0xff, 0},
+		{0, 1, 1},
+		{0b1010, 0b0101, 4},
+		{0, ^uint64(0), 64},
+	}
+
+	for _, test := range tests {
+		distance := HammingDistance(test.a, test.b)
+		if distance != test.distance {
+			t.Errorf("distance between %x and %x: expected %d, got %d", test.a, test.b, test.distance, distance)
+		}
+		if HammingDistance(test.b, test.a) != distance {
+			t.Errorf("distance between %x and %x is not symmetric", test.a, test.b)
+		}
+	}
+}
+
+// Get a page of count words picked from the article
+func simHashPage(random *rand.Rand, count int) []string {
+	vocabulary := Words([]byte(simHashArticle))
+
+	var words []string
+	for index := 0; index < count; index++ {
+		words = append(words, vocabulary[random.Intn(len(vocabulary))])
+	}
+
+	return words
+}
+
+func TestSimHashDistance(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	page := simHashPage(random, 500)
+
+	var withChangedWord []string = append([]string{}, page...)
+	withChangedWord[250] = "changed"
+
+	var withChangedWords []string = append([]string{}, page...)
+	for index := 50; index < len(page); index += 100 {
+		withChangedWords[index] = "changed"
+	}
+
+	tests := []struct {
+		name        string
+		other       []string
+		minDistance int
+		maxDistance int
+	}{
+		{"same page", page, 0, 0},
+		{"one word changed", withChangedWord, 0, 3},
+		{"a few words changed", withChangedWords, 0, 3},
+		{"session id added", append(append([]string{}, page...), "session", "8f3a2c"), 0, 3},
+		// further than the largest allowed duplicates.max_distance
+		{"unrelated page", simHashPage(random, 500), 17, 64},
+	}
+
+	fingerprint := SimHash(page)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distance := HammingDistance(fingerprint, SimHash(test.other))
+			if distance < test.minDistance || distance > test.maxDistance {
+				t.Errorf("expected distance in [%d, %d], got %d", test.minDistance, test.maxDistance, distance)
+			}
+		})
+	}
+
+	changedCase := strings.ToUpper(strings.ReplaceAll(simHashArticle, ",", " ;"))
+	if SimHash(Words([]byte(simHashArticle))) != SimHash(Words([]byte(changedCase))) {
+		t.Errorf("expected case and punctuation not to change the fingerprint")
+	}
+}
+
+func TestSimHashShortText(t *testing.T) {
+	if SimHash(nil) != 0 {
+		t.Errorf("expected empty text to have zero fingerprint")
+	}
+
+	if SimHash([]string{"wecr", "crawler"}) == 0 {
+		t.Errorf("expected text shorter than a shingle to have a fingerprint")
+	}
+}
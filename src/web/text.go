@@ -21,8 +21,6 @@ package web
 import (
 	"bufio"
 	"bytes"
-	"net"
-	"net/mail"
 	"net/url"
 	"regexp"
 	"strings"
@@ -34,8 +32,6 @@ var tagHrefRegexp *regexp.Regexp = regexp.MustCompile(`(?i)(href)[\s]*=[\s]*("|'
 // matches src="link" or even something along the lines of SrC    =  'link'
 var tagSrcRegexp *regexp.Regexp = regexp.MustCompile(`(?i)(src)[\s]*=[\s]*("|')(.*?)("|')`)
 
-var emailRegexp *regexp.Regexp = regexp.MustCompile(`[A-Za-z0-9._%+\-!%&?~^#$]+@[A-Za-z0-9.\-]+\.[a-zA-Z]{2,4}`)
-
 // Fix relative link and construct an absolute one. Does nothing if the URL already looks alright
 func ResolveLink(link url.URL, fromHost string) url.URL {
 	var resolvedURL url.URL = link
@@ -181,50 +177,3 @@ func IsTextOnPage(text string, ignoreCase bool, pageBody []byte) bool {
 func FindPageRegexp(re *regexp.Regexp, pageBody []byte) []string {
 	return re.FindAllString(string(pageBody), -1)
 }
-
-// Extract clear email addresses on the page
-func FindPageEmails(pageBody []byte) []string {
-	var emailAddresses []string
-
-	var skip bool
-	for _, email := range emailRegexp.FindAllString(string(pageBody), -1) {
-		skip = false
-
-		_, err := mail.ParseAddress(email)
-		if err != nil {
-			continue
-		}
-
-		for _, visitedEmail := range emailAddresses {
-			if email == visitedEmail {
-				skip = true
-				break
-			}
-		}
-
-		if skip {
-			continue
-		}
-
-		emailAddresses = append(emailAddresses, email)
-	}
-
-	return emailAddresses
-}
-
-// Extract clear email addresses on the page and make an MX lookup
-func FindPageEmailsWithCheck(pageBody []byte) []string {
-	var filteredEmailAddresses []string
-
-	emailAddresses := FindPageEmails(pageBody)
-	for _, email := range emailAddresses {
-		mx, err := net.LookupMX(strings.Split(email, "@")[1])
-		if err != nil || len(mx) == 0 {
-			continue
-		}
-
-		filteredEmailAddresses = append(filteredEmailAddresses, email)
-	}
-
-	return filteredEmailAddresses
-}
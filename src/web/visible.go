@@ -0,0 +1,240 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Elements whose contents are never visible
+var invisibleElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"head":     true,
+	"svg":      true,
+	"iframe":   true,
+	"object":   true,
+}
+
+// Elements that start a new line of text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// Where text starting at Offset of the text extracted from a page comes from
+type TextOrigin struct {
+	Offset int
+	// Line of the page, starting from 1
+	Line int
+	// Text of the nearest heading above
+	Heading string
+	// Name of the nearest element the text follows, ie: "p"
+	Element string
+}
+
+// Whether element is a heading
+func isHeading(element string) bool {
+	return len(element) == 2 && element[0] == 'h' && element[1] >= '1' && element[1] <= '6'
+}
+
+// Extract text of the page as a reader sees it: without markup, scripts, styles and comments,
+// with entities decoded and whitespace collapsed. Block elements (ie: paragraphs, list items)
+// are put on their own lines, so words of different blocks do not run together
+func VisibleText(pageBody []byte) []byte {
+	text, _ := visibleText(pageBody, false)
+	return text
+}
+
+// Extract visible text of the page (see VisibleText) along with where its parts come from
+func VisibleTextOrigins(pageBody []byte) ([]byte, []TextOrigin) {
+	return visibleText(pageBody, true)
+}
+
+func visibleText(pageBody []byte, withOrigins bool) ([]byte, []TextOrigin) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(pageBody))
+
+	var text bytes.Buffer
+	var origins []TextOrigin
+	var line int = 1
+	var invisibleDepth int = 0
+	var element, heading string
+	var headingText strings.Builder
+	var inHeading bool = false
+	// whether there are words on the current line, whether the next word goes on a new line
+	// and whether it is separated by whitespace from the previous one
+	var lineHasText, newLine, space bool
+	for {
+		tokenType := tokenizer.Next()
+		// raw token changes once it is parsed
+		tokenLine := line
+		line += bytes.Count(tokenizer.Raw(), []byte("\n"))
+
+		switch tokenType {
+		case html.ErrorToken:
+			// end of the page
+			return text.Bytes(), origins
+
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			token := tokenizer.Token()
+			if invisibleElements[token.Data] && token.Type != html.SelfClosingTagToken {
+				if token.Type == html.StartTagToken {
+					invisibleDepth++
+				} else if invisibleDepth > 0 {
+					invisibleDepth--
+				}
+			}
+
+			if blockElements[token.Data] && lineHasText {
+				newLine = true
+				lineHasText = false
+			}
+
+			switch {
+			case token.Type == html.EndTagToken && isHeading(token.Data) && inHeading:
+				heading = strings.Join(strings.Fields(headingText.String()), " ")
+				inHeading = false
+			case token.Type == html.StartTagToken && isHeading(token.Data):
+				headingText.Reset()
+				inHeading = true
+				element = token.Data
+			case token.Type != html.EndTagToken:
+				element = token.Data
+			}
+
+		case html.TextToken:
+			if invisibleDepth != 0 {
+				continue
+			}
+
+			data := tokenizer.Text()
+			if inHeading {
+				headingText.Write(data)
+			}
+
+			for index := 0; index < len(data); {
+				char, size := utf8.DecodeRune(data[index:])
+				if unicode.IsSpace(char) {
+					space = true
+					index += size
+					continue
+				}
+
+				wordEnd := index
+				for wordEnd < len(data) {
+					char, size := utf8.DecodeRune(data[wordEnd:])
+					if unicode.IsSpace(char) {
+						break
+					}
+					wordEnd += size
+				}
+
+				if newLine {
+					text.WriteByte('\n')
+					newLine = false
+				} else if space && lineHasText {
+					text.WriteByte(' ')
+				}
+				space = false
+
+				if withOrigins {
+					origin := TextOrigin{
+						Offset:  text.Len(),
+						Line:    tokenLine + bytes.Count(data[:index], []byte("\n")),
+						Heading: heading,
+						Element: element,
+					}
+					last := len(origins) - 1
+					if last < 0 || origins[last].Line != origin.Line ||
+						origins[last].Heading != origin.Heading || origins[last].Element != origin.Element {
+						origins = append(origins, origin)
+					}
+				}
+
+				text.Write(data[index:wordEnd])
+				lineHasText = true
+				index = wordEnd
+			}
+		}
+	}
+}
+
+// Get the title of the page. Returns an empty string if there is none
+func PageTitle(pageBody []byte) string {
+	title, _ := pageTitle(pageBody)
+	return title
+}
+
+// Get the title of the page along with where it comes from
+func PageTitleOrigins(pageBody []byte) ([]byte, []TextOrigin) {
+	title, line := pageTitle(pageBody)
+	if title == "" {
+		return nil, nil
+	}
+
+	return []byte(title), []TextOrigin{{Offset: 0, Line: line, Element: "title"}}
+}
+
+// Get the title of the page and the line it starts on
+func pageTitle(pageBody []byte) (string, int) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(pageBody))
+
+	var inTitle bool = false
+	var title strings.Builder
+	var line, titleLine int = 1, 0
+	for {
+		tokenType := tokenizer.Next()
+		tokenLine := line
+		line += bytes.Count(tokenizer.Raw(), []byte("\n"))
+
+		switch tokenType {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(title.String()), " "), titleLine
+
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "title" {
+				inTitle = true
+				titleLine = tokenLine
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if string(name) == "title" {
+				return strings.Join(strings.Fields(title.String()), " "), titleLine
+			}
+
+		case html.TextToken:
+			if inTitle {
+				title.Write(tokenizer.Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package web
+
+import "testing"
+
+const visiblePage string = `<html><head><title>
+  Fruit &amp; bread</title><style>p {}</style></head><body>
+<h1>Fruit</h1>
+<p>Apples are <b>red</b>
+or green.</p><script>var apples;</script>
+<h2>Other <i>food</i></h2>
+<ul><li>Bread</li><li>Milk</li></ul>
+</body></html>`
+
+func TestVisibleText(t *testing.T) {
+	expected := "Fruit\nApples are red or green.\nOther food\nBread\nMilk"
+	if text := string(VisibleText([]byte(visiblePage))); text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+}
+
+func TestVisibleTextOrigins(t *testing.T) {
+	text, origins := VisibleTextOrigins([]byte(visiblePage))
+	if string(text) != string(VisibleText([]byte(visiblePage))) {
+		t.Errorf("expected the same text as VisibleText, got %q", text)
+	}
+
+	expected := []TextOrigin{
+		{Offset: 0, Line: 3, Heading: "", Element: "h1"},
+		{Offset: 6, Line: 4, Heading: "Fruit", Element: "p"},
+		{Offset: 17, Line: 4, Heading: "Fruit", Element: "b"},
+		{Offset: 21, Line: 5, Heading: "Fruit", Element: "b"},
+		{Offset: 31, Line: 6, Heading: "Fruit", Element: "h2"},
+		{Offset: 37, Line: 6, Heading: "Fruit", Element: "i"},
+		{Offset: 42, Line: 7, Heading: "Other food", Element: "li"},
+	}
+	if len(origins) != len(expected) {
+		t.Fatalf("expected %d origins, got %+v", len(expected), origins)
+	}
+	for index, origin := range origins {
+		if origin != expected[index] {
+			t.Errorf("origin %d: expected %+v, got %+v", index, expected[index], origin)
+		}
+	}
+}
+
+func TestPageTitleOrigins(t *testing.T) {
+	title, origins := PageTitleOrigins([]byte(visiblePage))
+	if string(title) != "Fruit & bread" {
+		t.Errorf("expected title %q, got %q", "Fruit & bread", title)
+	}
+	if len(origins) != 1 || origins[0] != (TextOrigin{Offset: 0, Line: 1, Element: "title"}) {
+		t.Errorf("expected the title to come from line 1, got %+v", origins)
+	}
+
+	if title, origins := PageTitleOrigins([]byte("<p>no title</p>")); title != nil || origins != nil {
+		t.Errorf("expected no title, got %q from %+v", title, origins)
+	}
+}
+
+func TestTextMatchContexts(t *testing.T) {
+	text, origins := VisibleTextOrigins([]byte(visiblePage))
+	matches := TextMatchContexts(text, origins, [][]int{{6, 12}, {21, 23}, {42, 47}}, 4)
+
+	expected := []Match{
+		{Text: "Apples", Before: "uit ", After: " are", Line: 4, Heading: "Fruit", Element: "p"},
+		{Text: "or", Before: "red ", After: " gre", Line: 5, Heading: "Fruit", Element: "b"},
+		{Text: "Bread", Before: "ood ", After: " Mil", Line: 7, Heading: "Other food", Element: "li"},
+	}
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d matches, got %+v", len(expected), matches)
+	}
+	for index, match := range matches {
+		if match != expected[index] {
+			t.Errorf("match %d: expected %+v, got %+v", index, expected[index], match)
+		}
+	}
+
+	// nothing is known of text without origins
+	matches = TextMatchContexts([]byte("http://example.com/apples"), nil, [][]int{{19, 25}}, 3)
+	if len(matches) != 1 || matches[0] != (Match{Text: "apples", Before: "om/"}) {
+		t.Errorf("expected a match without line, heading and element, got %+v", matches)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"sync"
+	"time"
+	"unbewohnte/wecr/config"
+)
+
+// Reasons for the crawl to end
+const (
+	StopReasonMaxPages    string = "page budget exhausted"
+	StopReasonMaxBytes    string = "byte budget exhausted"
+	StopReasonMaxDuration string = "time budget exhausted"
+	StopReasonNothingLeft string = "no pages left to visit"
+)
+
+// Category of files that do not fall into any other one
+const otherFilesCategory string = "other"
+
+// Limits of the whole crawl shared by every worker of the pool
+type Budget struct {
+	conf      config.Budget
+	pages     uint64
+	bytes     uint64
+	hostPages map[string]uint64
+	files     map[string]uint64
+	reason    string
+	done      chan struct{}
+	timer     *time.Timer
+	lock      sync.Mutex
+}
+
+// Create a new budget with nothing spent
+func NewBudget(conf config.Budget) *Budget {
+	return &Budget{
+		conf:      conf,
+		hostPages: make(map[string]uint64),
+		files:     make(map[string]uint64),
+		done:      make(chan struct{}),
+	}
+}
+
+// Mark budget as exhausted for the reason. Only the first reason is kept
+func (b *Budget) exhaust(reason string) {
+	if b.reason != "" {
+		return
+	}
+
+	b.reason = reason
+	close(b.done)
+}
+
+// End the crawl for the reason unless it has ended already
+func (b *Budget) end(reason string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.exhaust(reason)
+}
+
+// Start counting down the time budget, if there is one. Does nothing if it has been started already
+func (b *Budget) startTimer() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.conf.MaxDurationMinutes == 0 || b.timer != nil {
+		return
+	}
+
+	b.timer = time.AfterFunc(time.Duration(b.conf.MaxDurationMinutes)*time.Minute, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		b.exhaust(StopReasonMaxDuration)
+	})
+}
+
+// Take a page visit to host out of the budget. Returns false if the page must not be visited
+// because the budget has been exhausted or host has had its share of pages
+func (b *Budget) TakePage(host string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.reason != "" {
+		return false
+	}
+
+	if b.conf.MaxPagesPerHost != 0 && b.hostPages[host] >= b.conf.MaxPagesPerHost {
+		return false
+	}
+
+	b.pages++
+	b.hostPages[host]++
+	if b.conf.MaxPages != 0 && b.pages >= b.conf.MaxPages {
+		// let this last page be processed
+		b.exhaust(StopReasonMaxPages)
+	}
+
+	return true
+}
+
+// Count downloaded bytes
+func (b *Budget) AddBytes(count uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.bytes += count
+	if b.conf.MaxBytes != 0 && b.bytes >= b.conf.MaxBytes {
+		b.exhaust(StopReasonMaxBytes)
+	}
+}
+
+// Take a file of category (ie: "images") out of the budget. Returns false
+// if no more files of this category must be saved
+func (b *Budget) TakeFile(category string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.reason != "" {
+		return false
+	}
+
+	if b.conf.MaxFilesPerCategory != 0 && b.files[category] >= b.conf.MaxFilesPerCategory {
+		return false
+	}
+	b.files[category]++
+
+	return true
+}
+
+// Get the reason the budget has been exhausted for. Empty if it has not been
+func (b *Budget) Reason() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.reason
+}
+
+// Get a channel that is closed once the budget is exhausted
+func (b *Budget) Done() <-chan struct{} {
+	return b.done
+}
@@ -0,0 +1,112 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"testing"
+	"unbewohnte/wecr/config"
+)
+
+// Check whether the budget has been exhausted for reason, empty reason meaning it has not
+func checkExhausted(t *testing.T, budget *Budget, reason string) {
+	t.Helper()
+
+	if budget.Reason() != reason {
+		t.Fatalf("expected budget to be exhausted for %q, got %q", reason, budget.Reason())
+	}
+
+	select {
+	case <-budget.Done():
+		if reason == "" {
+			t.Fatalf("expected budget not to be done")
+		}
+	default:
+		if reason != "" {
+			t.Fatalf("expected budget to be done")
+		}
+	}
+}
+
+func TestBudgetPages(t *testing.T) {
+	budget := NewBudget(config.Budget{MaxPages: 3, MaxPagesPerHost: 2})
+
+	for _, page := range []struct {
+		host  string
+		taken bool
+	}{
+		{"a.org", true},
+		{"a.org", true},
+		{"a.org", false},
+		{"b.org", true},
+	} {
+		if budget.TakePage(page.host) != page.taken {
+			t.Fatalf("expected page of %s to be taken: %v", page.host, page.taken)
+		}
+	}
+	// the last page is visited, the ones after it are not
+	checkExhausted(t, budget, StopReasonMaxPages)
+
+	if budget.TakePage("c.org") {
+		t.Errorf("expected no pages to be taken from exhausted budget")
+	}
+}
+
+func TestBudgetBytes(t *testing.T) {
+	budget := NewBudget(config.Budget{MaxBytes: 100})
+
+	budget.AddBytes(60)
+	checkExhausted(t, budget, "")
+	budget.AddBytes(40)
+	checkExhausted(t, budget, StopReasonMaxBytes)
+
+	// the first reason stays
+	budget.end(StopReasonNothingLeft)
+	checkExhausted(t, budget, StopReasonMaxBytes)
+}
+
+func TestBudgetFiles(t *testing.T) {
+	budget := NewBudget(config.Budget{MaxFilesPerCategory: 1})
+
+	if !budget.TakeFile("images") || budget.TakeFile("images") {
+		t.Errorf("expected only one image to be taken")
+	}
+	if !budget.TakeFile(otherFilesCategory) {
+		t.Errorf("expected categories to have their own limits")
+	}
+	checkExhausted(t, budget, "")
+
+	budget.end(StopReasonNothingLeft)
+	checkExhausted(t, budget, StopReasonNothingLeft)
+	if budget.TakeFile("audio") {
+		t.Errorf("expected no files to be taken after the crawl has ended")
+	}
+}
+
+func TestBudgetUnlimited(t *testing.T) {
+	budget := NewBudget(config.Budget{})
+	budget.startTimer()
+
+	for i := 0; i < 1000; i++ {
+		if !budget.TakePage("a.org") || !budget.TakeFile("images") {
+			t.Fatalf("expected unlimited budget to take everything")
+		}
+		budget.AddBytes(1 << 20)
+	}
+	checkExhausted(t, budget, "")
+}
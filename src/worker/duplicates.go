@@ -0,0 +1,164 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"sort"
+	"sync"
+	"unbewohnte/wecr/web"
+)
+
+// Pages with fewer words are too short to be told apart by their fingerprints and are never duplicates
+const minFingerprintWords int = 10
+
+// How many duplicate URLs of a cluster are remembered
+const clusterExamplesLimit int = 10
+
+// Page that has been visited first and its near-duplicates that have been skipped
+type DuplicateCluster struct {
+	Job      string   `json:"job,omitempty"`
+	Page     string   `json:"page"`
+	Count    uint64   `json:"count"`
+	Examples []string `json:"examples"`
+}
+
+// Bits of fingerprints a band index is made of
+type fingerprintBand struct {
+	shift uint
+	mask  uint64
+	// indices of fingerprints by the value of their band bits
+	fingerprints map[uint64][]int
+}
+
+// Fingerprints of visited pages of a crawl job
+type Duplicates struct {
+	maxDistance  int
+	fingerprints []uint64
+	pages        []string
+	// Fingerprints differing in maxDistance bits at most have at least one of maxDistance+1 bands
+	// the same, so only the ones sharing a band with a page need to be compared with it
+	bands    []fingerprintBand
+	clusters map[int]*DuplicateCluster
+	lock     sync.Mutex
+}
+
+// Create an empty index of pages. Pages with fingerprints that differ in maxDistance bits at most are duplicates
+func NewDuplicates(maxDistance uint) *Duplicates {
+	var bandsCount uint = maxDistance + 1
+	if bandsCount > 64 {
+		bandsCount = 64
+	}
+
+	duplicates := &Duplicates{
+		maxDistance: int(maxDistance),
+		bands:       make([]fingerprintBand, bandsCount),
+		clusters:    make(map[int]*DuplicateCluster),
+	}
+
+	// split 64 bits as evenly as possible
+	var shift uint = 0
+	for index := range duplicates.bands {
+		width := 64 / bandsCount
+		if uint(index) < 64%bandsCount {
+			width++
+		}
+
+		duplicates.bands[index] = fingerprintBand{
+			shift:        shift,
+			mask:         ^uint64(0) >> (64 - width),
+			fingerprints: make(map[uint64][]int),
+		}
+		shift += width
+	}
+
+	return duplicates
+}
+
+// Check whether page with text is a near-duplicate of one visited before. If it is, returns the URL
+// of that page and counts the duplicate in its cluster, otherwise remembers the page
+func (d *Duplicates) Check(pageURL string, text []byte) (original string, duplicate bool) {
+	words := web.Words(text)
+	if len(words) < minFingerprintWords {
+		return "", false
+	}
+
+	return d.check(pageURL, web.SimHash(words))
+}
+
+// Check whether page with fingerprint is a near-duplicate of one visited before, see Check
+func (d *Duplicates) check(pageURL string, fingerprint uint64) (original string, duplicate bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// the page visited first among the near ones
+	var index int = -1
+	for _, band := range d.bands {
+		for _, candidate := range band.fingerprints[fingerprint>>band.shift&band.mask] {
+			if (index == -1 || candidate < index) &&
+				web.HammingDistance(fingerprint, d.fingerprints[candidate]) <= d.maxDistance {
+				index = candidate
+			}
+		}
+	}
+
+	if index != -1 {
+		cluster, ok := d.clusters[index]
+		if !ok {
+			cluster = &DuplicateCluster{Page: d.pages[index]}
+			d.clusters[index] = cluster
+		}
+		cluster.Count++
+		if len(cluster.Examples) < clusterExamplesLimit {
+			cluster.Examples = append(cluster.Examples, pageURL)
+		}
+
+		return d.pages[index], true
+	}
+
+	for _, band := range d.bands {
+		key := fingerprint >> band.shift & band.mask
+		band.fingerprints[key] = append(band.fingerprints[key], len(d.fingerprints))
+	}
+	d.fingerprints = append(d.fingerprints, fingerprint)
+	d.pages = append(d.pages, pageURL)
+
+	return "", false
+}
+
+// Get clusters of pages that have had duplicates, the largest first
+func (d *Duplicates) Clusters() []DuplicateCluster {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var clusters []DuplicateCluster = make([]DuplicateCluster, 0, len(d.clusters))
+	for _, cluster := range d.clusters {
+		clusterCopy := *cluster
+		clusterCopy.Examples = append([]string(nil), cluster.Examples...)
+		clusters = append(clusters, clusterCopy)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Count != clusters[j].Count {
+			return clusters[i].Count > clusters[j].Count
+		}
+		return clusters[i].Page < clusters[j].Page
+	})
+
+	return clusters
+}
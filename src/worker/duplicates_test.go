@@ -0,0 +1,108 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"unbewohnte/wecr/web"
+)
+
+// Get index of the first fingerprint within maxDistance of fingerprint, -1 if there is none
+func nearestByComparingAll(fingerprints []uint64, fingerprint uint64, maxDistance int) int {
+	for index, known := range fingerprints {
+		if web.HammingDistance(fingerprint, known) <= maxDistance {
+			return index
+		}
+	}
+
+	return -1
+}
+
+func TestDuplicatesBands(t *testing.T) {
+	for _, maxDistance := range []uint{0, 1, 3, 7, 16} {
+		t.Run(fmt.Sprint(maxDistance), func(t *testing.T) {
+			random := rand.New(rand.NewSource(int64(maxDistance)))
+			duplicates := NewDuplicates(maxDistance)
+
+			var fingerprints []uint64
+			for round := 0; round < 2000; round++ {
+				// pages near the ones seen before are common
+				fingerprint := random.Uint64()
+				if len(fingerprints) != 0 && random.Intn(2) == 0 {
+					fingerprint = fingerprints[random.Intn(len(fingerprints))]
+					for flips := random.Intn(int(maxDistance) + 3); flips > 0; flips-- {
+						fingerprint ^= 1 << random.Intn(64)
+					}
+				}
+
+				pageURL := fmt.Sprintf("/%d", round)
+				expected := nearestByComparingAll(fingerprints, fingerprint, int(maxDistance))
+				original, duplicate := duplicates.check(pageURL, fingerprint)
+				if duplicate != (expected != -1) {
+					t.Fatalf("fingerprint %x: expected duplicate = %v", fingerprint, expected != -1)
+				}
+				if !duplicate {
+					fingerprints = append(fingerprints, fingerprint)
+					continue
+				}
+
+				if original != duplicates.pages[expected] {
+					t.Fatalf("fingerprint %x: expected duplicate of %s, got %s", fingerprint, duplicates.pages[expected], original)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicatesCheck(t *testing.T) {
+	page := strings.Repeat("wecr crawls the web looking for text emails images and documents ", 5)
+
+	duplicates := NewDuplicates(3)
+	checks := []struct {
+		url       string
+		text      string
+		duplicate bool
+	}{
+		{"/short", "too short to be a duplicate", false},
+		{"/short-again", "too short to be a duplicate", false},
+		{"/page", page, false},
+		{"/page?session=1", page + " session 1", true},
+		{"/page?print", strings.ToUpper(page), true},
+		{"/other", strings.Repeat("a completely different page about cooking pasta with tomatoes and basil ", 5), false},
+	}
+
+	for _, check := range checks {
+		original, duplicate := duplicates.Check(check.url, []byte(check.text))
+		if duplicate != check.duplicate {
+			t.Errorf("%s: expected duplicate = %v", check.url, check.duplicate)
+		}
+		if duplicate && original != "/page" {
+			t.Errorf("%s: expected duplicate of /page, got %s", check.url, original)
+		}
+	}
+
+	clusters := duplicates.Clusters()
+	if len(clusters) != 1 || clusters[0].Page != "/page" || clusters[0].Count != 2 ||
+		strings.Join(clusters[0].Examples, ",") != "/page?session=1,/page?print" {
+		t.Errorf("unexpected clusters %+v", clusters)
+	}
+}
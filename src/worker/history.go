@@ -0,0 +1,211 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unbewohnte/wecr/web"
+)
+
+// How many of the latest results and errors are kept in memory. The results limit is
+// mentioned on the results page and in README
+const (
+	historyResultsLimit int = 1000
+	historyErrorsLimit  int = 250
+)
+
+const (
+	ResultTypeText     string = "text"
+	ResultTypeEmail    string = "email"
+	ResultTypeFile     string = "file"
+	ResultTypeRecord   string = "record"
+	ResultTypeMetadata string = "metadata"
+	ResultTypeChange   string = "change"
+)
+
+// Result that has been found and outputted by one of the workers.
+// For files Data contains paths relative to the output directory, so does SavedPage.
+// For records and metadata Data contains each one of them in JSON, for changes - the diff
+type ResultRecord struct {
+	Job     string   `json:"job,omitempty"`
+	Rule    string   `json:"rule,omitempty"`
+	PageURL string   `json:"page_url"`
+	Query   string   `json:"query"`
+	Type    string   `json:"type"`
+	Data    []string `json:"data"`
+	// Context of text matches, if captured
+	Matches   []web.Match `json:"matches,omitempty"`
+	SavedPage string      `json:"saved_page,omitempty"`
+	TimeUnix  uint64      `json:"time_unix"`
+}
+
+// Criteria for picking remembered results. Empty fields match everything
+type ResultFilter struct {
+	// Host of the page the result was found on
+	Host string
+	// Text that the page URL or any of the data entries contain
+	Term string
+	// Type of the result
+	Type string
+	// Name of the crawl job that found the result
+	Job string
+	// Name of the search rule that found the result
+	Rule string
+}
+
+// Check whether result satisfies the filter
+func (f ResultFilter) matches(result ResultRecord) bool {
+	if f.Type != "" && result.Type != f.Type {
+		return false
+	}
+
+	if f.Job != "" && result.Job != f.Job {
+		return false
+	}
+
+	if f.Rule != "" && result.Rule != f.Rule {
+		return false
+	}
+
+	if f.Host != "" {
+		pageURL, err := url.Parse(result.PageURL)
+		if err != nil || !strings.EqualFold(pageURL.Host, f.Host) {
+			return false
+		}
+	}
+
+	if f.Term != "" {
+		term := strings.ToLower(f.Term)
+		if strings.Contains(strings.ToLower(result.PageURL), term) {
+			return true
+		}
+
+		for _, entry := range result.Data {
+			if strings.Contains(strings.ToLower(entry), term) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// Error that occured while processing a page
+type ErrorRecord struct {
+	URL      string `json:"url"`
+	Error    string `json:"error"`
+	TimeUnix uint64 `json:"time_unix"`
+}
+
+// Latest results and errors of the whole worker pool
+type History struct {
+	results []ResultRecord
+	errors  []ErrorRecord
+	lock    sync.Mutex
+}
+
+// Create a new empty history
+func NewHistory() *History {
+	return &History{
+		results: nil,
+		errors:  nil,
+	}
+}
+
+// Remember a new result, forgetting the oldest one if there are too many
+func (h *History) AddResult(result ResultRecord) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if result.TimeUnix == 0 {
+		result.TimeUnix = uint64(time.Now().Unix())
+	}
+
+	h.results = append(h.results, result)
+	if len(h.results) > historyResultsLimit {
+		h.results = h.results[len(h.results)-historyResultsLimit:]
+	}
+}
+
+// Attach the path of the locally saved copy of the page to every remembered result job found on it
+func (h *History) MarkPageSaved(job string, pageURL string, savedPage string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i := range h.results {
+		if h.results[i].Job == job && h.results[i].PageURL == pageURL {
+			h.results[i].SavedPage = savedPage
+		}
+	}
+}
+
+// Remember a new error, forgetting the oldest one if there are too many
+func (h *History) AddError(url string, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.errors = append(h.errors, ErrorRecord{
+		URL:      url,
+		Error:    err.Error(),
+		TimeUnix: uint64(time.Now().Unix()),
+	})
+	if len(h.errors) > historyErrorsLimit {
+		h.errors = h.errors[len(h.errors)-historyErrorsLimit:]
+	}
+}
+
+// Get remembered results that satisfy filter, newest first, skipping offset of them and returning no more than limit.
+// Also returns the total number of remembered results that satisfy filter
+func (h *History) Results(filter ResultFilter, offset uint, limit uint) ([]ResultRecord, uint) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var total uint = 0
+	var page []ResultRecord = []ResultRecord{}
+	for i := len(h.results) - 1; i >= 0; i-- {
+		if !filter.matches(h.results[i]) {
+			continue
+		}
+
+		if total >= offset && uint(len(page)) < limit {
+			page = append(page, h.results[i])
+		}
+		total++
+	}
+
+	return page, total
+}
+
+// Get no more than limit of remembered errors, newest first
+func (h *History) Errors(limit uint) []ErrorRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var errors []ErrorRecord = []ErrorRecord{}
+	for i := len(h.errors) - 1; i >= 0 && uint(len(errors)) < limit; i-- {
+		errors = append(errors, h.errors[i])
+	}
+
+	return errors
+}
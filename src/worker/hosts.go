@@ -0,0 +1,93 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"sync"
+)
+
+// Statistics of a single host
+type HostStats struct {
+	Visited           uint64 `json:"visited"`
+	Errors            uint64 `json:"errors"`
+	ConsecutiveErrors uint64 `json:"consecutive_errors"`
+}
+
+// Per-host statistics of the whole worker pool
+type Hosts struct {
+	stats map[string]*HostStats
+	lock  sync.Mutex
+}
+
+// Create new empty per-host statistics
+func NewHosts() *Hosts {
+	return &Hosts{
+		stats: make(map[string]*HostStats),
+	}
+}
+
+// Get statistics of host, creating them if there are none. Must be called with the lock held
+func (h *Hosts) get(host string) *HostStats {
+	stats, ok := h.stats[host]
+	if !ok {
+		stats = &HostStats{}
+		h.stats[host] = stats
+	}
+
+	return stats
+}
+
+// Count a visit to host
+func (h *Hosts) AddVisit(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.get(host).Visited++
+}
+
+// Count a failed request to host
+func (h *Hosts) AddError(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	stats := h.get(host)
+	stats.Errors++
+	stats.ConsecutiveErrors++
+}
+
+// Note a successful request to host, resetting its consecutive errors
+func (h *Hosts) AddSuccess(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.get(host).ConsecutiveErrors = 0
+}
+
+// Get a copy of statistics of every known host
+func (h *Hosts) All() map[string]HostStats {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var all map[string]HostStats = make(map[string]HostStats, len(h.stats))
+	for host, stats := range h.stats {
+		all[host] = *stats
+	}
+
+	return all
+}
@@ -0,0 +1,79 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"net/url"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/web"
+)
+
+// Visited page with the parts that search rules look in, extracted once when first needed
+type page struct {
+	URL          *url.URL
+	HTML         []byte
+	text         []byte
+	textOrigins  []web.TextOrigin
+	title        []byte
+	titleOrigins []web.TextOrigin
+}
+
+// Get the part of the page to search in scope
+func (p *page) in(scope string) []byte {
+	switch scope {
+	case config.SearchScopeText:
+		if p.text == nil {
+			p.text, p.textOrigins = web.VisibleTextOrigins(p.HTML)
+		}
+		return p.text
+
+	case config.SearchScopeTitle:
+		if p.title == nil {
+			p.title, p.titleOrigins = web.PageTitleOrigins(p.HTML)
+			if p.title == nil {
+				p.title = []byte{}
+			}
+		}
+		return p.title
+
+	case config.SearchScopeURL:
+		return []byte(p.URL.String())
+
+	default:
+		return p.HTML
+	}
+}
+
+// Get contexts of matches at locations in the part of the page to search in scope.
+// Matches in extracted text and title keep the lines, headings and elements of the page
+func (p *page) contexts(scope string, locations [][]int, contextChars uint) []web.Match {
+	switch scope {
+	case config.SearchScopeText:
+		return web.TextMatchContexts(p.in(scope), p.textOrigins, locations, contextChars)
+
+	case config.SearchScopeTitle:
+		return web.TextMatchContexts(p.in(scope), p.titleOrigins, locations, contextChars)
+
+	case config.SearchScopeURL:
+		return web.TextMatchContexts(p.in(scope), nil, locations, contextChars)
+
+	default:
+		return web.MatchContexts(p.HTML, locations, contextChars)
+	}
+}
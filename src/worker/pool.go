@@ -19,9 +19,13 @@
 package worker
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unbewohnte/wecr/web"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/logger"
+	"unbewohnte/wecr/queue"
 )
 
 // Already visited URLs
@@ -32,55 +36,262 @@ type visited struct {
 
 // Whole worker pool's statistics
 type Statistics struct {
-	PagesVisited  uint64 `json:"pages_visited"`
-	MatchesFound  uint64 `json:"matches_found"`
-	PagesSaved    uint64 `json:"pages_saved"`
-	StartTimeUnix uint64 `json:"start_time_unix"`
-	Stopped       bool   `json:"stopped"`
+	PagesVisited    uint64 `json:"pages_visited"`
+	MatchesFound    uint64 `json:"matches_found"`
+	PagesSaved      uint64 `json:"pages_saved"`
+	BytesDownloaded uint64 `json:"bytes_downloaded"`
+	ChangesDetected uint64 `json:"changes_detected"`
+	// Near-duplicates of visited pages that have been skipped and their clusters
+	DuplicatesSkipped uint64             `json:"duplicates_skipped"`
+	DuplicateClusters []DuplicateCluster `json:"duplicate_clusters,omitempty"`
+	StartTimeUnix     uint64             `json:"start_time_unix"`
+	Stopped           bool               `json:"stopped"`
+	// Why the crawl has ended by itself, ie: "page budget exhausted"
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+// Get a copy of statistics. Counters are changed by many workers at once,
+// so they are only accessed atomically
+func (s *Statistics) Snapshot() Statistics {
+	var snapshot Statistics = *s
+	snapshot.PagesVisited = atomic.LoadUint64(&s.PagesVisited)
+	snapshot.MatchesFound = atomic.LoadUint64(&s.MatchesFound)
+	snapshot.PagesSaved = atomic.LoadUint64(&s.PagesSaved)
+	snapshot.BytesDownloaded = atomic.LoadUint64(&s.BytesDownloaded)
+	snapshot.ChangesDetected = atomic.LoadUint64(&s.ChangesDetected)
+	snapshot.DuplicatesSkipped = atomic.LoadUint64(&s.DuplicatesSkipped)
+
+	return snapshot
 }
 
 // Web-Worker pool
 type Pool struct {
 	workersCount uint
 	workers      []*Worker
-	visited      visited
+	jobs         map[string]*JobConf
 	Stats        *Statistics
+	History      *History
+	Hosts        *Hosts
+	VisitQueue   *queue.VisitQueue
+	conf         *WorkerConf
+	budget       *Budget
+	running      sync.WaitGroup
+	// whether goroutine of the worker at the same index is running, guarded by lock
+	active []bool
+	start  sync.Once
+	lock   sync.Mutex
+	// whether to end the crawl once there is nothing left to visit
+	endWhenIdle bool
 }
 
-// Create a new worker pool
-func NewWorkerPool(initialJobs chan web.Job, workerCount uint, workerConf *WorkerConf, stats *Statistics) *Pool {
+// Create a new worker pool that stops once any of the budget limits is reached
+func NewWorkerPool(workerCount uint, workerConf *WorkerConf, stats *Statistics, budget config.Budget) *Pool {
 	var newPool Pool = Pool{
 		workersCount: workerCount,
 		workers:      nil,
-		visited: visited{
-			URLs: nil,
-			Lock: sync.Mutex{},
-		},
-		Stats: stats,
+		jobs:         workerConf.Jobs,
+		Stats:        stats,
+		History:      NewHistory(),
+		Hosts:        NewHosts(),
+		VisitQueue:   workerConf.VisitQueue,
+		conf:         workerConf,
+		budget:       NewBudget(budget),
+		active:       make([]bool, workerCount),
 	}
 
 	var i uint
 	for i = 0; i < workerCount; i++ {
-		newWorker := NewWorker(initialJobs, workerConf, &newPool.visited, newPool.Stats)
+		newWorker := NewWorker(i, workerConf, newPool.Stats, newPool.History, newPool.Hosts, newPool.budget)
 		newPool.workers = append(newPool.workers, &newWorker)
 	}
 
 	return &newPool
 }
 
-// Notify all workers in pool to start scraping
+// Change configuration that workers read while crawling, see WorkerConf.Reconfigure
+func (p *Pool) Reconfigure(change func()) {
+	p.conf.Reconfigure(change)
+}
+
+// Read configuration that can be changed while crawling, see WorkerConf.View
+func (p *Pool) ViewConf(read func()) {
+	p.conf.View(read)
+}
+
+// Get the number of workers in the pool
+func (p *Pool) WorkersCount() uint {
+	return p.workersCount
+}
+
+// Get statistics of every crawl job by job name
+func (p *Pool) JobStats() map[string]Statistics {
+	var stats map[string]Statistics = make(map[string]Statistics, len(p.jobs))
+	for name, job := range p.jobs {
+		jobStats := job.Stats.Snapshot()
+		jobStats.DuplicateClusters = p.jobClusters(name, job)
+		jobStats.StartTimeUnix = p.Stats.StartTimeUnix
+		jobStats.Stopped = p.Stats.Stopped
+		jobStats.StopReason = p.Stats.StopReason
+		stats[name] = jobStats
+	}
+
+	return stats
+}
+
+// Get duplicate clusters of job tagged with its name, none if it does not look for duplicates
+func (p *Pool) jobClusters(name string, job *JobConf) []DuplicateCluster {
+	if job.Duplicates == nil {
+		return nil
+	}
+
+	clusters := job.Duplicates.Clusters()
+	for index := range clusters {
+		clusters[index].Job = name
+	}
+
+	return clusters
+}
+
+// Get statistics of the whole crawl with duplicate clusters of every job, the largest first
+func (p *Pool) Statistics() Statistics {
+	var stats Statistics = p.Stats.Snapshot()
+	stats.DuplicateClusters = nil
+	for name, job := range p.jobs {
+		stats.DuplicateClusters = append(stats.DuplicateClusters, p.jobClusters(name, job)...)
+	}
+	sort.SliceStable(stats.DuplicateClusters, func(i, j int) bool {
+		return stats.DuplicateClusters[i].Count > stats.DuplicateClusters[j].Count
+	})
+
+	return stats
+}
+
+// Notify all workers in pool to start scraping. The crawl is started only once, later calls resume it
 func (p *Pool) Work() {
-	p.Stats.StartTimeUnix = uint64(time.Now().Unix())
+	p.start.Do(func() {
+		p.Stats.StartTimeUnix = uint64(time.Now().Unix())
+
+		p.budget.startTimer()
+		if p.endWhenIdle {
+			go p.watchIdle()
+		}
+		go func() {
+			<-p.budget.Done()
+			p.Stats.StopReason = p.budget.Reason()
+			logger.Info("Stopping: %s", p.Stats.StopReason)
+			p.Stop()
+		}()
+	})
+
+	p.Resume()
+}
+
+// Let stopped workers continue scraping. Workers that are still finishing their pages carry on,
+// the ones that have quit are started again. A crawl that has ended by itself is not resumed
+func (p *Pool) Resume() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.budget.Reason() != "" {
+		return
+	}
+
 	p.Stats.Stopped = false
+	for index, worker := range p.workers {
+		worker.Stopped = false
+		if p.active[index] {
+			continue
+		}
+
+		p.active[index] = true
+		p.running.Add(1)
+		go p.run(index)
+	}
+}
+
+// Keep worker at index working until it quits while the pool is stopped
+func (p *Pool) run(index int) {
+	defer p.running.Done()
 
+	worker := p.workers[index]
+	for {
+		worker.Work()
+
+		p.lock.Lock()
+		if worker.Stopped {
+			p.active[index] = false
+			p.lock.Unlock()
+			return
+		}
+		// resumed before it has quit
+		p.lock.Unlock()
+	}
+}
+
+// End the crawl once the visit queue is empty and no worker is visiting a page. Must be called before Work
+func (p *Pool) EndWhenIdle() {
+	p.endWhenIdle = true
+}
+
+// Whether the visit queue is empty and every worker is waiting for a job
+func (p *Pool) idle() bool {
 	for _, worker := range p.workers {
-		worker.Stopped = false
-		go worker.Work()
+		if worker.busy() {
+			return false
+		}
 	}
+
+	empty, err := p.VisitQueue.IsEmpty()
+	return err == nil && empty
+}
+
+// End the crawl once the pool has been idle for two checks in a row. A paused pool is not idle
+func (p *Pool) watchIdle() {
+	var idleChecks uint = 0
+	for {
+		select {
+		case <-p.budget.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		if p.Stats.Stopped || !p.idle() {
+			idleChecks = 0
+			continue
+		}
+		idleChecks++
+		if idleChecks >= 2 {
+			p.budget.end(StopReasonNothingLeft)
+		}
+	}
+}
+
+// Get a channel that is closed once the crawl has ended by itself because of an exhausted budget
+// or, if asked to, because there is nothing left to visit
+func (p *Pool) Done() <-chan struct{} {
+	return p.budget.Done()
+}
+
+// Whether the crawl has ended because every page has been visited
+func (p *Pool) Complete() bool {
+	return p.budget.Reason() == StopReasonNothingLeft
+}
+
+// Get the reason the crawl has ended by itself for. Empty if it has not
+func (p *Pool) StopReason() string {
+	return p.budget.Reason()
+}
+
+// Wait for every worker to finish its current page after the pool has been stopped
+func (p *Pool) Wait() {
+	p.running.Wait()
 }
 
 // Notify all workers in pool to stop scraping
 func (p *Pool) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	p.Stats.Stopped = true
 	for _, worker := range p.workers {
 		worker.Stopped = true
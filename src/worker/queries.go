@@ -0,0 +1,130 @@
+/*
+	Wecr - crawl the web for data
+	Copyright (C) 2023 Kasyanov Nikolay Alexeyevich (Unbewohnte)
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"regexp"
+	"sync"
+	"unbewohnte/wecr/boolquery"
+	"unbewohnte/wecr/config"
+	"unbewohnte/wecr/web"
+)
+
+// Text or regexp query of a search rule, ready to be matched against pages
+type compiledQuery struct {
+	// Set for regexp queries
+	re *regexp.Regexp
+	// Set for boolean queries
+	boolean *boolquery.Query
+	// Set for plain text and boolean queries
+	matcher *web.TextMatcher
+}
+
+// What a query is compiled from
+type queryKey struct {
+	query         string
+	isRegexp      bool
+	isBoolean     bool
+	caseSensitive bool
+	wholeWord     bool
+}
+
+// Queries of search rules and extraction selectors compiled once and shared by workers.
+// Search can change while crawling, so they are compiled the first time they are needed
+type queryCache struct {
+	queries map[queryKey]*compiledQuery
+	// extractors by extraction settings encoded in JSON
+	extractors map[string]*web.Extractor
+	lock       sync.Mutex
+}
+
+// Get compiled query of rule, compiling it if it is met for the first time
+func (c *queryCache) get(rule config.SearchRule) (*compiledQuery, error) {
+	key := queryKey{
+		query:         rule.Query,
+		isRegexp:      rule.IsRegexp,
+		isBoolean:     rule.IsBoolean,
+		caseSensitive: rule.CaseSensitive,
+		wholeWord:     rule.WholeWord,
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if query, ok := c.queries[key]; ok {
+		return query, nil
+	}
+
+	var query compiledQuery
+	switch {
+	case rule.IsRegexp:
+		re, err := regexp.Compile(rule.Query)
+		if err != nil {
+			return nil, err
+		}
+		query.re = re
+
+	case rule.IsBoolean:
+		boolean, err := boolquery.Parse(rule.Query)
+		if err != nil {
+			return nil, err
+		}
+		query.boolean = boolean
+		// negated terms are looked for too
+		query.matcher = web.NewTextMatcher(boolean.AllTerms(), rule.CaseSensitive, rule.WholeWord)
+
+	default:
+		query.matcher = web.NewTextMatcher([]string{rule.Query}, rule.CaseSensitive, rule.WholeWord)
+	}
+
+	if c.queries == nil {
+		c.queries = make(map[queryKey]*compiledQuery)
+	}
+	c.queries[key] = &query
+
+	return &query, nil
+}
+
+// Get extractor of extraction settings, compiling its selectors if they are met for the first time
+func (c *queryCache) extractor(extract config.Extract) (*web.Extractor, error) {
+	key, err := json.Marshal(extract)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if extractor, ok := c.extractors[string(key)]; ok {
+		return extractor, nil
+	}
+
+	extractor, err := web.NewExtractor(extract)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.extractors == nil {
+		c.extractors = make(map[string]*web.Extractor)
+	}
+	c.extractors[string(key)] = extractor
+
+	return extractor, nil
+}
@@ -27,54 +27,195 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unbewohnte/wecr/config"
 	"unbewohnte/wecr/logger"
+	"unbewohnte/wecr/monitor"
 	"unbewohnte/wecr/queue"
+	"unbewohnte/wecr/scope"
 	"unbewohnte/wecr/web"
 )
 
-type VisitQueue struct {
-	VisitQueue *os.File
-	Lock       *sync.Mutex
+// Crawl job configuration. Visits of every job are taken from the same queue by the same workers
+type JobConf struct {
+	Name   string
+	Search *config.Search
+	// Save.OutputDir is the output directory of this job
+	Save *config.Save
+	// Output directory of this job relative to the root one in slash form, empty for the only job
+	OutputSubdir string
+	// Which URLs are crawled
+	Scope *scope.Rules
+	// Which pages are on site relative to the initial page, see config.CrawlModeAny
+	CrawlMode string
+	// How many links in a row may lead off site
+	OffsiteHops  uint
+	TextOutput   io.Writer
+	EmailsOutput io.Writer
+	// Output of page metadata unless a rule has its own
+	MetadataOutput io.Writer
+	// Outputs of search rules that have their own output file by rule name
+	RuleOutputs map[string]io.Writer
+	// Output of extracted records and the path it has been opened at relative to the output directory
+	RecordsOutput     io.Writer
+	RecordsOutputFile string
+	// Change detection against the previous crawl, nil if pages are not watched
+	Monitor *monitor.Monitor
+	// Fingerprints of visited pages, nil if near-duplicates are not skipped
+	Duplicates *Duplicates
+	Stats      *Statistics
+	visited    visited
 }
 
 // Worker configuration
 type WorkerConf struct {
-	Search             *config.Search
-	Requests           *config.Requests
-	Save               *config.Save
-	BlacklistedDomains []string
-	AllowedDomains     []string
-	VisitQueue         VisitQueue
-	TextOutput         io.Writer
-	EmailsOutput       io.Writer
+	Requests   *config.Requests
+	VisitQueue *queue.VisitQueue
+	// Crawl jobs by their names
+	Jobs map[string]*JobConf
+	// Verifier of found email addresses shared by workers
+	EmailVerifier *web.EmailVerifier
+	// Compiled queries of search rules
+	queries queryCache
+	// Guards Requests along with searches, scopes and search outputs of jobs, which can be changed while crawling
+	lock sync.RWMutex
+}
+
+// Change configuration that workers read while crawling. Workers never see it half-changed
+func (c *WorkerConf) Reconfigure(change func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	change()
+}
+
+// Read configuration that can be changed while crawling. It does not change until read returns
+func (c *WorkerConf) View(read func()) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	read()
+}
+
+// Get current request settings
+func (c *WorkerConf) requests() config.Requests {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return *c.Requests
+}
+
+// Get current search and scope of job
+func (c *WorkerConf) jobSearch(jobConf *JobConf) (config.Search, *scope.Rules) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return *jobConf.Search, jobConf.Scope
 }
 
 // Web worker
 type Worker struct {
-	Jobs    chan web.Job
+	ID      uint
 	Conf    *WorkerConf
-	visited *visited
 	stats   *Statistics
+	history *History
+	hosts   *Hosts
+	budget  *Budget
 	Stopped bool
+	// 1 while the worker has a job at hand or is queueing links of a visited page
+	working int32
+	pushing int32
 }
 
 // Create a new worker
-func NewWorker(jobs chan web.Job, conf *WorkerConf, visited *visited, stats *Statistics) Worker {
+func NewWorker(id uint, conf *WorkerConf, stats *Statistics, history *History, hosts *Hosts, budget *Budget) Worker {
 	return Worker{
-		Jobs:    jobs,
+		ID:      id,
 		Conf:    conf,
-		visited: visited,
 		stats:   stats,
+		history: history,
+		hosts:   hosts,
+		budget:  budget,
 		Stopped: false,
 	}
 }
 
-func (w *Worker) saveContent(links []url.URL, pageURL *url.URL) {
+// Check whether link is on site of job: in scope and, according to crawl mode, on the same site
+// as seed. Denied is true if link is explicitly denied by rule and must not be visited at all
+func (w *Worker) onSite(jobConf *JobConf, link *url.URL, seed *url.URL) (onSite bool, denied bool, rule *scope.Rule) {
+	_, rules := w.Conf.jobSearch(jobConf)
+	allowed, rule := rules.Match(link)
+	if !allowed && rule != nil {
+		return false, true, rule
+	}
+
+	return allowed && scope.SameSite(jobConf.CrawlMode, link, seed), false, rule
+}
+
+// Find email addresses on page and verify them the way search of job asks to
+func (w *Worker) findEmails(job web.Job, pageData []byte) []string {
+	return w.Conf.EmailVerifier.Verify(web.FindPageEmails(pageData), job.Search.EmailVerification)
+}
+
+// Whether the worker is visiting a page or queueing its links
+func (w *Worker) busy() bool {
+	return atomic.LoadInt32(&w.working) != 0 || atomic.LoadInt32(&w.pushing) != 0
+}
+
+// Count bytes downloaded for job
+func (w *Worker) addBytes(jobConf *JobConf, count uint64) {
+	atomic.AddUint64(&w.stats.BytesDownloaded, count)
+	atomic.AddUint64(&jobConf.Stats.BytesDownloaded, count)
+	w.budget.AddBytes(count)
+}
+
+// Count matches found for job
+func (w *Worker) addMatches(jobConf *JobConf, count uint64) {
+	atomic.AddUint64(&w.stats.MatchesFound, count)
+	atomic.AddUint64(&jobConf.Stats.MatchesFound, count)
+}
+
+// Fetch file to filePath, counting its size as downloaded
+func (w *Worker) fetchFile(jobConf *JobConf, link string, filePath string) error {
+	requests := w.Conf.requests()
+	err := web.FetchFile(
+		link,
+		requests.UserAgent,
+		requests.ContentFetchTimeoutMs,
+		filePath,
+	)
+	if err != nil {
+		return err
+	}
+
+	if stats, err := os.Stat(filePath); err == nil {
+		w.addBytes(jobConf, uint64(stats.Size()))
+	}
+
+	return nil
+}
+
+func (w *Worker) saveContent(jobConf *JobConf, links []url.URL, pageURL *url.URL, rule config.SearchRule) {
+	var savedFiles []string
+	defer func() {
+		if len(savedFiles) == 0 {
+			return
+		}
+
+		w.history.AddResult(ResultRecord{
+			Job:     jobConf.Name,
+			Rule:    rule.Name,
+			PageURL: pageURL.String(),
+			Query:   rule.Query,
+			Type:    ResultTypeFile,
+			Data:    savedFiles,
+		})
+	}()
+
 	var alreadyProcessedUrls []url.URL
 	for count, link := range links {
 		// check if this URL has been processed already
@@ -96,36 +237,51 @@ func (w *Worker) saveContent(links []url.URL, pageURL *url.URL) {
 		var fileName string = fmt.Sprintf("%s_%d_%s", pageURL.Host, count, path.Base(link.Path))
 
 		var filePath string
+		var category string
 		if web.HasImageExtention(link.Path) {
-			filePath = filepath.Join(w.Conf.Save.OutputDir, config.SaveImagesDir, fileName)
+			filePath = filepath.Join(jobConf.Save.OutputDir, config.SaveImagesDir, fileName)
+			category = config.SaveImagesDir
 		} else if web.HasVideoExtention(link.Path) {
-			filePath = filepath.Join(w.Conf.Save.OutputDir, config.SaveVideosDir, fileName)
+			filePath = filepath.Join(jobConf.Save.OutputDir, config.SaveVideosDir, fileName)
+			category = config.SaveVideosDir
 		} else if web.HasAudioExtention(link.Path) {
-			filePath = filepath.Join(w.Conf.Save.OutputDir, config.SaveAudioDir, fileName)
+			filePath = filepath.Join(jobConf.Save.OutputDir, config.SaveAudioDir, fileName)
+			category = config.SaveAudioDir
 		} else if web.HasDocumentExtention(link.Path) {
-			filePath = filepath.Join(w.Conf.Save.OutputDir, config.SaveDocumentsDir, fileName)
+			filePath = filepath.Join(jobConf.Save.OutputDir, config.SaveDocumentsDir, fileName)
+			category = config.SaveDocumentsDir
 		} else {
-			filePath = filepath.Join(w.Conf.Save.OutputDir, fileName)
+			filePath = filepath.Join(jobConf.Save.OutputDir, fileName)
+			category = otherFilesCategory
 		}
 
-		err := web.FetchFile(
-			link.String(),
-			w.Conf.Requests.UserAgent,
-			w.Conf.Requests.ContentFetchTimeoutMs,
-			filePath,
-		)
+		if !w.budget.TakeFile(category) {
+			logger.Debug("Skipped %s: no budget left for %s", link.String(), category)
+			continue
+		}
+
+		err := w.fetchFile(jobConf, link.String(), filePath)
 		if err != nil {
 			logger.Error("Failed to fetch file located at %s: %s", link.String(), err)
+			w.history.AddError(link.String(), err)
 			return
 		}
 
 		logger.Info("Outputted \"%s\"", fileName)
-		w.stats.MatchesFound++
+		w.addMatches(jobConf, 1)
+
+		relativePath, err := filepath.Rel(jobConf.Save.OutputDir, filePath)
+		if err != nil {
+			relativePath = fileName
+		}
+		savedFiles = append(savedFiles, path.Join(jobConf.OutputSubdir, filepath.ToSlash(relativePath)))
 	}
 }
 
-// Save page to the disk with a corresponding name; Download any src files, stylesheets and JS along the way
-func (w *Worker) savePage(baseURL url.URL, pageData []byte) {
+// Save page to the disk with a corresponding name; Download any src files, stylesheets and JS along the way.
+// Returns the path of the saved page file relative to the root output directory or an empty string
+// if the page could not be saved
+func (w *Worker) savePage(jobConf *JobConf, baseURL url.URL, pageData []byte) string {
 	var findPageFileContentURLs func([]byte) []url.URL = func(pageBody []byte) []url.URL {
 		var urls []url.URL
 
@@ -157,20 +313,20 @@ func (w *Worker) savePage(baseURL url.URL, pageData []byte) {
 		baseURL.Host,
 		strings.ReplaceAll(baseURL.Path, "/", "_"),
 	)
-	err := os.MkdirAll(filepath.Join(w.Conf.Save.OutputDir, config.SavePagesDir, pageFilesDirectoryName), os.ModePerm)
+	err := os.MkdirAll(filepath.Join(jobConf.Save.OutputDir, config.SavePagesDir, pageFilesDirectoryName), os.ModePerm)
 	if err != nil {
 		logger.Error("Failed to create directory to store file contents of %s: %s", baseURL.String(), err)
-		return
+		return ""
 	}
 
 	// Save files on page
 	srcLinks := findPageFileContentURLs(pageData)
 	for _, srcLink := range srcLinks {
-		web.FetchFile(srcLink.String(),
-			w.Conf.Requests.UserAgent,
-			w.Conf.Requests.ContentFetchTimeoutMs,
+		w.fetchFile(
+			jobConf,
+			srcLink.String(),
 			filepath.Join(
-				w.Conf.Save.OutputDir,
+				jobConf.Save.OutputDir,
 				config.SavePagesDir,
 				pageFilesDirectoryName,
 				path.Base(srcLink.String()),
@@ -195,44 +351,354 @@ func (w *Worker) savePage(baseURL url.URL, pageData []byte) {
 		strings.ReplaceAll(baseURL.Path, "/", "_"),
 	)
 	outfile, err := os.Create(filepath.Join(
-		filepath.Join(w.Conf.Save.OutputDir, config.SavePagesDir),
+		filepath.Join(jobConf.Save.OutputDir, config.SavePagesDir),
 		pageName,
 	))
 	if err != nil {
-		fmt.Printf("Failed to create output file: %s\n", err)
+		logger.Error("Failed to create output file: %s", err)
+		return ""
 	}
 	defer outfile.Close()
 
 	outfile.Write(pageData)
 
 	logger.Info("Saved \"%s\"", pageName)
-	w.stats.PagesSaved++
+	atomic.AddUint64(&w.stats.PagesSaved, 1)
+	atomic.AddUint64(&jobConf.Stats.PagesSaved, 1)
+
+	return path.Join(jobConf.OutputSubdir, config.SavePagesDir, pageName)
 }
 
 const (
-	textTypeMatch = iota
-	textTypeEmail = iota
+	textTypeMatch    = iota
+	textTypeEmail    = iota
+	textTypeRecord   = iota
+	textTypeMetadata = iota
 )
 
 // Save text result to an appropriate file
-func (w *Worker) saveResult(result web.Result, textType int) {
+func (w *Worker) saveResult(jobConf *JobConf, result web.Result, textType int) {
 	// write result to the output file
 	var output io.Writer
 	switch textType {
 	case textTypeEmail:
-		output = w.Conf.EmailsOutput
+		output = jobConf.EmailsOutput
+	case textTypeMetadata:
+		output = jobConf.MetadataOutput
 
 	default:
-		output = w.Conf.TextOutput
+		output = jobConf.TextOutput
 	}
+	w.Conf.View(func() {
+		if textType == textTypeRecord {
+			output = jobConf.RecordsOutput
+		}
+		if ruleOutput, ok := jobConf.RuleOutputs[result.Rule]; ok && result.Rule != "" {
+			output = ruleOutput
+		}
+	})
 
 	// each entry in output file is a self-standing JSON object
 	entryBytes, err := json.MarshalIndent(result, " ", "\t")
 	if err != nil {
 		return
 	}
-	output.Write(entryBytes)
-	output.Write([]byte("\n"))
+	if output != nil {
+		output.Write(entryBytes)
+		output.Write([]byte("\n"))
+	}
+
+	var resultType string = ResultTypeText
+	switch textType {
+	case textTypeEmail:
+		resultType = ResultTypeEmail
+	case textTypeRecord:
+		resultType = ResultTypeRecord
+	case textTypeMetadata:
+		resultType = ResultTypeMetadata
+	}
+	var data []string = result.Data
+	for _, record := range result.Records {
+		recordBytes, err := json.Marshal(record)
+		if err == nil {
+			data = append(data, string(recordBytes))
+		}
+	}
+	if result.Metadata != nil {
+		metadataBytes, err := json.Marshal(result.Metadata)
+		if err == nil {
+			data = append(data, string(metadataBytes))
+		}
+	}
+	w.history.AddResult(ResultRecord{
+		Job:     jobConf.Name,
+		Rule:    result.Rule,
+		PageURL: result.PageURL,
+		Query:   result.Search.Query,
+		Type:    resultType,
+		Data:    data,
+		Matches: result.Matches,
+	})
+}
+
+// Count and remember the change of a visited page
+func (w *Worker) reportChange(jobConf *JobConf, change monitor.Change, jobLog logger.FieldLogger) {
+	jobLog.Info("Page is %s", change.Type)
+	atomic.AddUint64(&w.stats.ChangesDetected, 1)
+	atomic.AddUint64(&jobConf.Stats.ChangesDetected, 1)
+	w.history.AddResult(ResultRecord{
+		Job:     jobConf.Name,
+		PageURL: change.URL,
+		Query:   change.Type,
+		Type:    ResultTypeChange,
+		Data:    change.Diff,
+	})
+}
+
+// Extract structured records from visited page, returns whether any have been found
+func (w *Worker) extract(jobConf *JobConf, job web.Job, visitedPage *page, jobLog logger.FieldLogger) bool {
+	extractor, err := w.Conf.queries.extractor(job.Search.Extract)
+	if err != nil {
+		jobLog.Error("Failed to extract records from %s: %s", job.URL, err)
+		return false
+	}
+
+	records, err := extractor.Records(visitedPage.HTML)
+	if err != nil {
+		jobLog.Error("Failed to extract records from %s: %s", job.URL, err)
+		w.history.AddError(job.URL, err)
+		return false
+	}
+	if len(records) == 0 {
+		return false
+	}
+
+	w.saveResult(jobConf, web.Result{
+		PageURL: job.URL,
+		Search:  job.Search,
+		Records: records,
+	}, textTypeRecord)
+	jobLog.Info("Extracted %d records", len(records))
+	w.addMatches(jobConf, uint64(len(records)))
+
+	return true
+}
+
+// Evaluate search rule on page data and output what has been found. Returns true if
+// anything has been found and the page is worth saving
+func (w *Worker) search(jobConf *JobConf, job web.Job, rule config.SearchRule, visitedPage *page, jobLog logger.FieldLogger) bool {
+	var pageURL *url.URL = visitedPage.URL
+	var pageData []byte = visitedPage.HTML
+	var search config.Search = config.Search{
+		IsRegexp:      rule.IsRegexp,
+		Query:         rule.Query,
+		IsBoolean:     rule.IsBoolean,
+		CaseSensitive: rule.CaseSensitive,
+		WholeWord:     rule.WholeWord,
+	}
+	if rule.Name != "" {
+		jobLog = jobLog.With(logger.Fields{"rule": rule.Name})
+	}
+
+	switch rule.Query {
+	case config.QueryArchive:
+		return true
+
+	case config.QueryPhone, config.QueryIP, config.QueryURL, config.QueryIBAN,
+		config.QueryCreditCard, config.QueryCryptoWallet, config.QuerySocialHandle:
+		// search for text entities
+		entities, _ := web.FindEntities(rule.Query, visitedPage.in(rule.Scope))
+		if len(entities) > 0 {
+			w.saveResult(jobConf, web.Result{
+				PageURL: job.URL,
+				Search:  search,
+				Rule:    rule.Name,
+				Data:    entities,
+			}, textTypeMatch)
+			jobLog.Info("Found %s entities: %+v", rule.Query, entities)
+			w.addMatches(jobConf, uint64(len(entities)))
+			return true
+		}
+
+	case config.QueryMetadata:
+		// find JSON-LD, OpenGraph and Twitter meta tags, microdata, title, description and language
+		metadata, err := web.FindPageMetadata(pageData)
+		if err != nil {
+			jobLog.Error("Failed to find metadata of %s: %s", job.URL, err)
+			w.history.AddError(job.URL, err)
+			return false
+		}
+		if !metadata.IsEmpty() {
+			w.saveResult(jobConf, web.Result{
+				PageURL:  job.URL,
+				Search:   search,
+				Rule:     rule.Name,
+				Metadata: &metadata,
+			}, textTypeMetadata)
+			w.addMatches(jobConf, 1)
+			return true
+		}
+
+	case config.QueryImages:
+		// find image URLs, output images to the file while not saving already outputted ones
+		imageLinks := web.FindPageImages(pageData, *pageURL)
+		if len(imageLinks) > 0 {
+			w.saveContent(jobConf, imageLinks, pageURL, rule)
+			return true
+		}
+
+	case config.QueryVideos:
+		// search for videos
+		// find video URLs, output videos to the files while not saving already outputted ones
+		videoLinks := web.FindPageVideos(pageData, *pageURL)
+		if len(videoLinks) > 0 {
+			w.saveContent(jobConf, videoLinks, pageURL, rule)
+			return true
+		}
+
+	case config.QueryAudio:
+		// search for audio
+		// find audio URLs, output audio to the file while not saving already outputted ones
+		audioLinks := web.FindPageAudio(pageData, *pageURL)
+		if len(audioLinks) > 0 {
+			w.saveContent(jobConf, audioLinks, pageURL, rule)
+			return true
+		}
+
+	case config.QueryDocuments:
+		// search for various documents
+		// find documents URLs, output docs to the file while not saving already outputted ones
+		docsLinks := web.FindPageDocuments(pageData, *pageURL)
+		if len(docsLinks) > 0 {
+			w.saveContent(jobConf, docsLinks, pageURL, rule)
+			return true
+		}
+
+	case config.QueryEmail:
+		// search for email
+		emailAddresses := w.findEmails(job, pageData)
+		if len(emailAddresses) > 0 {
+			w.saveResult(jobConf, web.Result{
+				PageURL: job.URL,
+				Search:  search,
+				Rule:    rule.Name,
+				Data:    emailAddresses,
+			}, textTypeEmail)
+			w.addMatches(jobConf, uint64(len(emailAddresses)))
+			return true
+		}
+
+	case config.QueryEverything:
+		// search for everything
+		var savePage bool = false
+
+		// files
+		var contentLinks []url.URL
+		contentLinks = append(contentLinks, web.FindPageImages(pageData, *pageURL)...)
+		contentLinks = append(contentLinks, web.FindPageAudio(pageData, *pageURL)...)
+		contentLinks = append(contentLinks, web.FindPageVideos(pageData, *pageURL)...)
+		contentLinks = append(contentLinks, web.FindPageDocuments(pageData, *pageURL)...)
+		w.saveContent(jobConf, contentLinks, pageURL, rule)
+
+		if len(contentLinks) > 0 {
+			savePage = true
+		}
+
+		// email
+		emailAddresses := w.findEmails(job, pageData)
+		if len(emailAddresses) > 0 {
+			w.saveResult(jobConf, web.Result{
+				PageURL: job.URL,
+				Search:  search,
+				Rule:    rule.Name,
+				Data:    emailAddresses,
+			}, textTypeEmail)
+			w.addMatches(jobConf, uint64(len(emailAddresses)))
+			savePage = true
+		}
+
+		return savePage
+
+	default:
+		// text search
+		query, err := w.Conf.queries.get(rule)
+		if err != nil {
+			jobLog.Error("Failed to compile query %s: %s", rule.Query, err)
+			w.history.AddError(job.URL, err)
+			return false
+		}
+
+		switch rule.IsRegexp {
+		case true:
+			// find by regexp
+			re := query.re
+
+			searchedData := visitedPage.in(rule.Scope)
+			matches := web.FindPageRegexp(re, searchedData)
+			if len(matches) > 0 {
+				var contexts []web.Match
+				if job.Search.ContextChars != 0 {
+					contexts = visitedPage.contexts(rule.Scope, re.FindAllIndex(searchedData, -1), job.Search.ContextChars)
+				}
+
+				w.saveResult(jobConf, web.Result{
+					PageURL: job.URL,
+					Search:  search,
+					Rule:    rule.Name,
+					Data:    matches,
+					Matches: contexts,
+				}, textTypeMatch)
+				jobLog.Info("Found matches: %+v", matches)
+				w.addMatches(jobConf, uint64(len(matches)))
+				return true
+			}
+		case false:
+			// just text
+			searchedData := visitedPage.in(rule.Scope)
+			matcher := query.matcher
+
+			var terms []string
+			if rule.IsBoolean {
+				matched, foundTerms := query.boolean.Match(func(term string) bool {
+					return matcher.Contains(searchedData, term)
+				})
+				// a page matching only because it lacks excluded terms has nothing to show
+				if !matched || len(foundTerms) == 0 {
+					return false
+				}
+				terms = foundTerms
+			} else if matcher.Contains(searchedData, rule.Query) {
+				terms = []string{rule.Query}
+			} else {
+				return false
+			}
+
+			var contexts []web.Match
+			if job.Search.ContextChars != 0 {
+				var locations [][]int
+				for _, term := range terms {
+					locations = append(locations, matcher.FindAll(searchedData, term, -1)...)
+				}
+				sort.Slice(locations, func(i, j int) bool {
+					return locations[i][0] < locations[j][0]
+				})
+				contexts = visitedPage.contexts(rule.Scope, locations, job.Search.ContextChars)
+			}
+
+			w.saveResult(jobConf, web.Result{
+				PageURL: job.URL,
+				Search:  search,
+				Rule:    rule.Name,
+				Data:    terms,
+				Matches: contexts,
+			}, textTypeMatch)
+			jobLog.Info("Found %q on page", terms)
+			w.addMatches(jobConf, uint64(len(terms)))
+			return true
+		}
+	}
+
+	return false
 }
 
 // Launch scraping process on this worker
@@ -242,75 +708,82 @@ func (w *Worker) Work() {
 	}
 
 	for {
-		var job web.Job
-		if w.Conf.VisitQueue.VisitQueue != nil {
-			w.Conf.VisitQueue.Lock.Lock()
-			newJob, err := queue.PopLastJob(w.Conf.VisitQueue.VisitQueue)
-			if err != nil {
-				logger.Error("Failed to get a new job from visit queue: %s", err)
-				w.Conf.VisitQueue.Lock.Unlock()
-				continue
-			}
-			if newJob == nil {
-				w.Conf.VisitQueue.Lock.Unlock()
-				continue
+		// taking a job counts as work so the queue is never empty with the job nowhere
+		atomic.StoreInt32(&w.working, 1)
+		newJob, err := w.Conf.VisitQueue.Pop()
+		if err != nil {
+			logger.Error("Failed to get a new job from visit queue: %s", err)
+		}
+		if err != nil || newJob == nil {
+			atomic.StoreInt32(&w.working, 0)
+			// nothing to do yet or the queue has failed, try again later
+			time.Sleep(time.Millisecond * 100)
+			if w.Stopped {
+				return
 			}
-
-			job = *newJob
-			w.Conf.VisitQueue.Lock.Unlock()
-		} else {
-			job = <-w.Jobs
+			continue
 		}
+		job := *newJob
 
 		// check if the worker has been stopped
 		if w.Stopped {
-			// stop working
+			// put the job back and stop working
+			w.Conf.VisitQueue.PushBack(job)
 			return
 		}
 
+		jobConf, ok := w.Conf.Jobs[job.Name]
+		if !ok {
+			logger.With(logger.Fields{"url": job.URL, "worker": w.ID}).Warning(
+				"Dropped %s of unknown job \"%s\"", job.URL, job.Name,
+			)
+			continue
+		}
+
 		pageURL, err := url.Parse(job.URL)
 		if err != nil {
-			logger.Error("Failed to parse URL \"%s\" to get hostname: %s", job.URL, err)
+			logger.With(logger.Fields{"url": job.URL, "worker": w.ID}).Error(
+				"Failed to parse URL \"%s\" to get hostname: %s", job.URL, err,
+			)
+			w.history.AddError(job.URL, err)
 			continue
 		}
 
-		var skip bool = false
-		// see if the domain is allowed and is not blacklisted
-		if len(w.Conf.AllowedDomains) > 0 {
-			skip = true
-			for _, allowedDomain := range w.Conf.AllowedDomains {
-				if pageURL.Host == allowedDomain {
-					skip = false
-					break
-				}
-			}
-			if skip {
-				logger.Info("Skipped non-allowed %s", job.URL)
-				continue
-			}
+		logFields := logger.Fields{
+			"url":    job.URL,
+			"host":   pageURL.Host,
+			"worker": w.ID,
+		}
+		if job.Name != "" {
+			logFields["job"] = job.Name
 		}
+		jobLog := logger.With(logFields)
 
-		if len(w.Conf.BlacklistedDomains) > 0 {
-			for _, blacklistedDomain := range w.Conf.BlacklistedDomains {
-				if pageURL.Host == blacklistedDomain {
-					skip = true
-					logger.Info("Skipped blacklisted %s", job.URL)
-					break
-				}
-			}
-			if skip {
-				continue
-			}
+		// see if the URL is in scope
+		var seedURL *url.URL = nil
+		if job.Seed != "" {
+			seedURL, _ = url.Parse(job.Seed)
+		}
+		onSite, denied, rule := w.onSite(jobConf, pageURL, seedURL)
+		if denied {
+			jobLog.Debug("Skipped %s out of scope by %s", job.URL, rule)
+			continue
+		}
+		if !onSite && (job.Hops == 0 || job.Hops > jobConf.OffsiteHops) {
+			// either the page has gone off site since it had been queued or it is too far off site
+			jobLog.Debug("Skipped %s off site", job.URL)
+			continue
 		}
 
+		var skip bool = false
 		// check if it is the first occurence
-		w.visited.Lock.Lock()
-		for _, visitedURL := range w.visited.URLs {
+		jobConf.visited.Lock.Lock()
+		for _, visitedURL := range jobConf.visited.URLs {
 			if job.URL == visitedURL {
 				// okay, don't even bother. Move onto the next job
 				skip = true
-				logger.Info("Skipping visited %s", job.URL)
-				w.visited.Lock.Unlock()
+				jobLog.Debug("Skipping visited %s", job.URL)
+				jobConf.visited.Lock.Unlock()
 				break
 			}
 		}
@@ -320,186 +793,128 @@ func (w *Worker) Work() {
 		}
 
 		// add this url to the visited list
-		w.visited.URLs = append(w.visited.URLs, job.URL)
-		w.visited.Lock.Unlock()
-		w.stats.PagesVisited++
+		jobConf.visited.URLs = append(jobConf.visited.URLs, job.URL)
+		jobConf.visited.Lock.Unlock()
+
+		if !w.budget.TakePage(pageURL.Host) {
+			jobLog.Debug("Skipped %s: no page budget left", job.URL)
+			continue
+		}
+		atomic.AddUint64(&w.stats.PagesVisited, 1)
+		atomic.AddUint64(&jobConf.Stats.PagesVisited, 1)
+		w.hosts.AddVisit(pageURL.Host)
 
 		// get page
-		logger.Info("Visiting %s", job.URL)
-		pageData, err := web.GetPage(job.URL, w.Conf.Requests.UserAgent, w.Conf.Requests.RequestWaitTimeoutMs)
+		jobLog.Debug("Visiting %s", job.URL)
+		requestStart := time.Now()
+		requests := w.Conf.requests()
+		pageData, err := web.GetPage(job.URL, requests.UserAgent, requests.RequestWaitTimeoutMs)
+		jobLog = jobLog.With(logger.Fields{"duration_ms": time.Since(requestStart).Milliseconds()})
 		if err != nil {
-			logger.Error("Failed to get \"%s\": %s", job.URL, err)
+			jobLog.Error("Failed to get \"%s\": %s", job.URL, err)
+			w.history.AddError(job.URL, err)
+			w.hosts.AddError(pageURL.Host)
+			if jobConf.Monitor != nil {
+				// a page that is only unreachable for now has not been removed
+				jobConf.Monitor.Failed(job.URL)
+			}
 			continue
 		}
+		w.hosts.AddSuccess(pageURL.Host)
+		w.addBytes(jobConf, uint64(len(pageData)))
+		jobLog.Debug("Visited %s", job.URL)
+
+		// compare with the previous crawl
+		if jobConf.Monitor != nil {
+			change, err := jobConf.Monitor.Check(job.URL, pageData)
+			if err != nil {
+				jobLog.Error("Failed to output change of %s: %s", job.URL, err)
+			} else if change != nil {
+				w.reportChange(jobConf, *change, jobLog)
+			}
+		}
+
+		// skip near-duplicates of visited pages along with their links
+		visitedPage := &page{
+			URL:  pageURL,
+			HTML: pageData,
+		}
+		if jobConf.Duplicates != nil {
+			original, duplicate := jobConf.Duplicates.Check(job.URL, visitedPage.in(config.SearchScopeText))
+			if duplicate {
+				jobLog.Debug("Skipping %s: near-duplicate of %s", job.URL, original)
+				atomic.AddUint64(&w.stats.DuplicatesSkipped, 1)
+				atomic.AddUint64(&jobConf.Stats.DuplicatesSkipped, 1)
+				time.Sleep(time.Duration(requests.RequestPauseMs * uint64(time.Millisecond)))
+				continue
+			}
+		}
 
 		// find links
 		pageLinks := web.FindPageLinks(pageData, *pageURL)
+		jobSearch, _ := w.Conf.jobSearch(jobConf)
+		atomic.AddInt32(&w.pushing, 1)
 		go func() {
+			defer atomic.AddInt32(&w.pushing, -1)
 			if job.Depth > 1 {
 				// decrement depth and add new jobs
 				job.Depth--
 
-				if w.Conf.VisitQueue.VisitQueue != nil {
-					// add to the visit queue
-					w.Conf.VisitQueue.Lock.Lock()
-					for _, link := range pageLinks {
-						if link.String() != job.URL {
-							err = queue.InsertNewJob(w.Conf.VisitQueue.VisitQueue, web.Job{
-								URL:    link.String(),
-								Search: *w.Conf.Search,
-								Depth:  job.Depth,
-							})
-							if err != nil {
-								logger.Error("Failed to encode a new job to a visit queue: %s", err)
+				for _, link := range pageLinks {
+					if link.String() != job.URL {
+						// off site links can be followed only for a few hops in a row
+						var hops uint = 0
+						linkOnSite, denied, _ := w.onSite(jobConf, &link, seedURL)
+						if denied {
+							continue
+						}
+						if !linkOnSite {
+							hops = job.Hops + 1
+							if hops > jobConf.OffsiteHops {
 								continue
 							}
 						}
-					}
-					w.Conf.VisitQueue.Lock.Unlock()
-				} else {
-					//  add to the in-memory channel
-					for _, link := range pageLinks {
-						if link.String() != job.URL {
-							w.Jobs <- web.Job{
-								URL:    link.String(),
-								Search: *w.Conf.Search,
-								Depth:  job.Depth,
-							}
+
+						err := w.Conf.VisitQueue.Push(web.Job{
+							URL:    link.String(),
+							Search: jobSearch,
+							Depth:  job.Depth,
+							Name:   job.Name,
+							Seed:   job.Seed,
+							Hops:   hops,
+						})
+						if err != nil {
+							logger.Error("Failed to encode a new job to a visit queue: %s", err)
+							continue
 						}
 					}
 				}
-
 			}
 			pageLinks = nil
 		}()
 
 		// process and output result
 		var savePage bool = false
-
-		switch job.Search.Query {
-		case config.QueryArchive:
-			savePage = true
-
-		case config.QueryImages:
-			// find image URLs, output images to the file while not saving already outputted ones
-			imageLinks := web.FindPageImages(pageData, *pageURL)
-			if len(imageLinks) > 0 {
-				w.saveContent(imageLinks, pageURL)
-				savePage = true
-			}
-
-		case config.QueryVideos:
-			// search for videos
-			// find video URLs, output videos to the files while not saving already outputted ones
-			videoLinks := web.FindPageVideos(pageData, *pageURL)
-			if len(videoLinks) > 0 {
-				w.saveContent(videoLinks, pageURL)
-				savePage = true
-			}
-
-		case config.QueryAudio:
-			// search for audio
-			// find audio URLs, output audio to the file while not saving already outputted ones
-			audioLinks := web.FindPageAudio(pageData, *pageURL)
-			if len(audioLinks) > 0 {
-				w.saveContent(audioLinks, pageURL)
-				savePage = true
-			}
-
-		case config.QueryDocuments:
-			// search for various documents
-			// find documents URLs, output docs to the file while not saving already outputted ones
-			docsLinks := web.FindPageDocuments(pageData, *pageURL)
-			if len(docsLinks) > 0 {
-				w.saveContent(docsLinks, pageURL)
-				savePage = true
-			}
-
-		case config.QueryEmail:
-			// search for email
-			emailAddresses := web.FindPageEmailsWithCheck(pageData)
-			if len(emailAddresses) > 0 {
-				w.saveResult(web.Result{
-					PageURL: job.URL,
-					Search:  job.Search,
-					Data:    emailAddresses,
-				}, textTypeEmail)
-				w.stats.MatchesFound += uint64(len(emailAddresses))
-				savePage = true
-			}
-
-		case config.QueryEverything:
-			// search for everything
-
-			// files
-			var contentLinks []url.URL
-			contentLinks = append(contentLinks, web.FindPageImages(pageData, *pageURL)...)
-			contentLinks = append(contentLinks, web.FindPageAudio(pageData, *pageURL)...)
-			contentLinks = append(contentLinks, web.FindPageVideos(pageData, *pageURL)...)
-			contentLinks = append(contentLinks, web.FindPageDocuments(pageData, *pageURL)...)
-			w.saveContent(contentLinks, pageURL)
-
-			if len(contentLinks) > 0 {
-				savePage = true
-			}
-
-			// email
-			emailAddresses := web.FindPageEmailsWithCheck(pageData)
-			if len(emailAddresses) > 0 {
-				w.saveResult(web.Result{
-					PageURL: job.URL,
-					Search:  job.Search,
-					Data:    emailAddresses,
-				}, textTypeEmail)
-				w.stats.MatchesFound += uint64(len(emailAddresses))
+		for _, rule := range job.Search.AllRules() {
+			if w.search(jobConf, job, rule, visitedPage, jobLog) {
 				savePage = true
 			}
-
-		default:
-			// text search
-			switch job.Search.IsRegexp {
-			case true:
-				// find by regexp
-				re, err := regexp.Compile(job.Search.Query)
-				if err != nil {
-					logger.Error("Failed to compile regexp %s: %s", job.Search.Query, err)
-					continue
-				}
-
-				matches := web.FindPageRegexp(re, pageData)
-				if len(matches) > 0 {
-					w.saveResult(web.Result{
-						PageURL: job.URL,
-						Search:  job.Search,
-						Data:    matches,
-					}, textTypeMatch)
-					logger.Info("Found matches: %+v", matches)
-					w.stats.MatchesFound += uint64(len(matches))
-					savePage = true
-				}
-			case false:
-				// just text
-				if web.IsTextOnPage(job.Search.Query, true, pageData) {
-					w.saveResult(web.Result{
-						PageURL: job.URL,
-						Search:  job.Search,
-						Data:    []string{job.Search.Query},
-					}, textTypeMatch)
-					logger.Info("Found \"%s\" on page", job.Search.Query)
-					w.stats.MatchesFound++
-					savePage = true
-				}
-			}
+		}
+		if job.Search.Extract.IsSet() && w.extract(jobConf, job, visitedPage, jobLog) {
+			savePage = true
 		}
 
 		// save page
-		if savePage && w.Conf.Save.SavePages {
-			w.savePage(*pageURL, pageData)
+		if savePage && jobConf.Save.SavePages {
+			savedPage := w.savePage(jobConf, *pageURL, pageData)
+			if savedPage != "" {
+				w.history.MarkPageSaved(job.Name, job.URL, savedPage)
+			}
 		}
 		pageData = nil
 		pageURL = nil
 
 		// sleep before the next request
-		time.Sleep(time.Duration(w.Conf.Requests.RequestPauseMs * uint64(time.Millisecond)))
+		time.Sleep(time.Duration(requests.RequestPauseMs * uint64(time.Millisecond)))
 	}
 }